@@ -1,19 +1,155 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"skasync/pkg/filesystem"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-func NewAPIListenerAndStart(cfg Config, fn func(*echo.Echo) error) error {
+// NewAPIListenerAndStart listens the unix socket or the port, writes the token and the discovery
+// file and serves the API. The requests are checked by the Host, the Origin and the token
+func NewAPIListenerAndStart(cfg Config, rootDir string, fn func(*echo.Echo) error) error {
+	paths := newRuntimePaths(cfg, rootDir)
+
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+	e.HTTPErrorHandler = errorHandler
+
+	e.Use(hostCheck(), originCheck(cfg.AllowedOrigins))
+
+	// The port falls back to a free one, so the files of the other running watcher are checked
+	// first. They are written once the socket or the port is taken
+	if pid := runningWatcherPID(paths); pid > 0 {
+		return fmt.Errorf("API discovery file %s is used by the running watcher (pid %d), stop it or set another API.RuntimeDir", paths.discoveryFile, pid)
+	}
+
+	listener, err := listen(cfg, paths)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	discovery := Discovery{
+		PID:       os.Getpid(),
+		Socket:    paths.socket,
+		StartedAt: time.Now(),
+	}
+
+	if cfg.EnableAuth {
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+
+		eventsToken, err := newToken()
+		if err != nil {
+			return err
+		}
+
+		if err := writeRuntimeFile(paths.tokenFile, []byte(token+"\n")); err != nil {
+			return fmt.Errorf("API token file: %w", err)
+		}
+
+		if err := writeRuntimeFile(paths.eventsTokenFile, []byte(eventsToken+"\n")); err != nil {
+			return fmt.Errorf("API events token file: %w", err)
+		}
+
+		e.Use(tokenAuth(token, eventsToken))
+		discovery.TokenFile = paths.tokenFile
+		discovery.EventsTokenFile = paths.eventsTokenFile
+	} else {
+		for _, filePath := range []string{paths.tokenFile, paths.eventsTokenFile} {
+			if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
 
 	if err := fn(e); err != nil {
 		return err
 	}
 
-	return e.Start(fmt.Sprintf("127.0.0.1:%d", cfg.Port))
+	discovery.URL = "http://localhost"
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok {
+		discovery.URL = fmt.Sprintf("http://127.0.0.1:%d", tcpAddr.Port)
+	}
+
+	data, err := json.MarshalIndent(discovery, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeRuntimeFile(paths.discoveryFile, data); err != nil {
+		return fmt.Errorf("API discovery file: %w", err)
+	}
+
+	if len(paths.socket) > 0 {
+		fmt.Printf("API listening at: %s\n", paths.socket)
+	} else {
+		fmt.Printf("API listening at: %s\n", discovery.URL)
+	}
+
+	e.Listener = listener
+
+	return e.Start("")
+}
+
+// RemoveRuntimeFiles removes the discovery file, the token and the socket of the stopped API
+func RemoveRuntimeFiles(cfg Config, rootDir string) {
+	removeRuntimeFiles(newRuntimePaths(cfg, rootDir))
+}
+
+func listen(cfg Config, paths runtimePaths) (net.Listener, error) {
+	if len(paths.socket) > 0 {
+		return listenSocket(paths.socket)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.Port))
+	if err == nil || cfg.Port == 0 || !errors.Is(err, syscall.EADDRINUSE) {
+		return listener, err
+	}
+
+	fmt.Printf("\033[33mAPI port %d is busy, a free port is picked\033[0m\n", cfg.Port)
+
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+// listenSocket listens the unix socket available to the user only. The socket left by the
+// crashed run is removed, the socket of the running watcher is kept
+func listenSocket(socketPath string) (net.Listener, error) {
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("API socket %s is used by another watcher", socketPath)
+		}
+
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := filesystem.MkdirPrivate(filepath.Dir(socketPath)); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
 }
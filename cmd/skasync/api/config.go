@@ -1,11 +1,69 @@
 package api
 
+import "path/filepath"
+
 type Config struct {
+	// Port of 127.0.0.1, 0 picks a free one. The busy port falls back to a free one as well,
+	// the clients find it in the discovery file
 	Port int
+	// Socket is the unix socket listened instead of the port, relative to the root dir
+	Socket string
+	// EnableAuth requires the bearer token of the token file, it is generated on every start.
+	// GET /events takes the token of the events token file as ?access_token= too, see tokenAuth
+	EnableAuth bool
+	// AllowedOrigins are the browser origins allowed to call the API, e.g. http://localhost:3000
+	AllowedOrigins []string
+	// RuntimeDir keeps the discovery file api.json and the token files api.token and events.token,
+	// relative to the root dir
+	RuntimeDir string
 }
 
 func DefaultConfig() Config {
 	return Config{
-		Port: 60001,
+		Port:       60001,
+		EnableAuth: true,
+		RuntimeDir: ".skasync",
+	}
+}
+
+// runtimePaths resolves the paths of the config relative to the root dir
+type runtimePaths struct {
+	discoveryFile,
+	tokenFile,
+	eventsTokenFile,
+	socket string
+}
+
+func newRuntimePaths(cfg Config, rootDir string) runtimePaths {
+	runtimeDir := cfg.RuntimeDir
+	if !filepath.IsAbs(runtimeDir) {
+		runtimeDir = filepath.Join(rootDir, runtimeDir)
+	}
+
+	paths := runtimePaths{
+		discoveryFile:   filepath.Join(runtimeDir, "api.json"),
+		tokenFile:       filepath.Join(runtimeDir, "api.token"),
+		eventsTokenFile: filepath.Join(runtimeDir, "events.token"),
 	}
+
+	if len(cfg.Socket) > 0 {
+		paths.socket = cfg.Socket
+		if !filepath.IsAbs(paths.socket) {
+			paths.socket = filepath.Join(rootDir, paths.socket)
+		}
+	}
+
+	return paths
+}
+
+// RuntimeFiles returns the files written by the API, the watcher must not take them for changes
+func RuntimeFiles(cfg Config, rootDir string) []string {
+	paths := newRuntimePaths(cfg, rootDir)
+
+	files := []string{paths.discoveryFile, paths.discoveryFile + ".tmp", paths.tokenFile, paths.tokenFile + ".tmp", paths.eventsTokenFile, paths.eventsTokenFile + ".tmp"}
+	if len(paths.socket) > 0 {
+		files = append(files, paths.socket)
+	}
+
+	return files
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"skasync/pkg/debug"
 	"strconv"
 
@@ -9,30 +10,49 @@ import (
 
 type DebugController struct {
 	debugChangeList *debug.ChangeList
+	endpointEvents  *debug.EndpointEvents
 }
 
-func NewDebugController(g *echo.Group, debugChangeList *debug.ChangeList) *DebugController {
-	ctrl := &DebugController{debugChangeList}
+func NewDebugController(g *echo.Group, debugChangeList *debug.ChangeList, endpointEvents *debug.EndpointEvents) *DebugController {
+	ctrl := &DebugController{debugChangeList, endpointEvents}
 
 	g.GET("/change-list/:id", ctrl.changeListHandler())
+	g.GET("/endpoint-events", ctrl.endpointEventsHandler())
 
 	return ctrl
 }
 
+func (ctrl *DebugController) endpointEventsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list := make([]echo.Map, 0)
+
+		for _, e := range ctrl.endpointEvents.List() {
+			list = append(list, echo.Map{
+				"time":        e.Time,
+				"tag":         e.TagName,
+				"context":     e.Context,
+				"namespace":   e.Namespace,
+				"podName":     e.PodName,
+				"prevPodName": e.PrevPodName,
+				"reason":      e.Reason,
+				"isRemoved":   e.IsRemoved,
+			})
+		}
+
+		return c.JSON(200, list)
+	}
+}
+
 func (ctrl *DebugController) changeListHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			return c.JSON(200, echo.Map{
-				"message": "incorrect id",
-			})
+			return newError(400, CodeInvalidParams, "id must be the change id")
 		}
 
 		list := ctrl.debugChangeList.Get(id)
 		if list == nil {
-			return c.JSON(200, echo.Map{
-				"message": "not found",
-			})
+			return newError(404, CodeChangeListNotFound, fmt.Sprintf("change list %d not found", id))
 		}
 
 		result := echo.Map{}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"skasync/pkg/filesystem"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Discovery is the discovery file of the running watcher, the clients find the API by it
+type Discovery struct {
+	PID int `json:"pid"`
+	// URL is the base URL of the API, http://localhost for the unix socket
+	URL       string `json:"url"`
+	Socket    string `json:"socket,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	// EventsTokenFile keeps the token of GET /events only, for the browser EventSource clients
+	EventsTokenFile string    `json:"eventsTokenFile,omitempty"`
+	StartedAt       time.Time `json:"startedAt"`
+}
+
+// Client calls the API of the running watcher found by the discovery file
+type Client struct {
+	Discovery
+	http  *http.Client
+	token string
+}
+
+// NewClient reads the discovery file and the token of the running watcher
+func NewClient(cfg Config, rootDir string, timeout time.Duration) (*Client, error) {
+	paths := newRuntimePaths(cfg, rootDir)
+
+	data, err := os.ReadFile(paths.discoveryFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("watcher is not running, discovery file %s is not found", paths.discoveryFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{http: &http.Client{Timeout: timeout}}
+	if err := json.Unmarshal(data, &client.Discovery); err != nil {
+		return nil, fmt.Errorf("discovery file %s: %w", paths.discoveryFile, err)
+	}
+
+	if len(client.TokenFile) > 0 {
+		token, err := os.ReadFile(client.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		client.token = strings.TrimSpace(string(token))
+	}
+
+	if len(client.Socket) > 0 {
+		socket := client.Socket
+		client.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+
+	return client, nil
+}
+
+func (cl *Client) Get(path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, cl.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cl.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+cl.token)
+	}
+
+	res, err := cl.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("watcher (pid %d) is not answering at %s, is it running? %w", cl.PID, cl.address(), err)
+	}
+
+	return res, nil
+}
+
+// GetJSON decodes the response into v, the error envelope is returned as *Error
+func (cl *Client) GetJSON(path string, v interface{}) error {
+	res, err := cl.Get(path)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		envelope := ErrorEnvelope{}
+		if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil || envelope.Error == nil {
+			return fmt.Errorf("watcher (pid %d) answered %s", cl.PID, res.Status)
+		}
+
+		envelope.Error.Status = res.StatusCode
+
+		return envelope.Error
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("watcher (pid %d) answer is not read: %w", cl.PID, err)
+	}
+
+	return nil
+}
+
+func (cl *Client) address() string {
+	if len(cl.Socket) > 0 {
+		return cl.Socket
+	}
+
+	return cl.URL
+}
+
+// writeRuntimeFile replaces the file by the rename, so the clients never read it half written.
+// The temp file left by the crashed run is removed, a new one is created with the user only mode
+func writeRuntimeFile(filePath string, data []byte) error {
+	if err := filesystem.MkdirPrivate(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+
+	tmpPath := filePath + ".tmp"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, filePath)
+}
+
+// runningWatcherPID returns the pid of the other running watcher of the discovery file, 0 if there is none
+func runningWatcherPID(paths runtimePaths) int {
+	discovery := Discovery{}
+	if data, err := os.ReadFile(paths.discoveryFile); err != nil || json.Unmarshal(data, &discovery) != nil {
+		return 0
+	}
+
+	if discovery.PID <= 0 || discovery.PID == os.Getpid() {
+		return 0
+	}
+
+	// The signal 0 only checks the process, EPERM is the process of another user
+	if err := syscall.Kill(discovery.PID, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return 0
+	}
+
+	return discovery.PID
+}
+
+// removeRuntimeFiles removes the files of the stopped API, the missing ones are skipped.
+// The files taken over by another watcher of the same runtime dir are kept
+func removeRuntimeFiles(paths runtimePaths) {
+	discovery := Discovery{}
+	if data, err := os.ReadFile(paths.discoveryFile); err == nil && json.Unmarshal(data, &discovery) == nil && discovery.PID != os.Getpid() {
+		return
+	}
+
+	for _, filePath := range []string{paths.discoveryFile, paths.tokenFile, paths.eventsTokenFile, paths.socket} {
+		if len(filePath) == 0 {
+			continue
+		}
+
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("\033[31mAPI file is not removed:\033[0m %s\n", err)
+		}
+	}
+}
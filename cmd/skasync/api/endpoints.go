@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"skasync/pkg/cli"
+	"skasync/pkg/k8s"
+	"skasync/pkg/sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+type EndpointsController struct {
+	podsCtrl    *k8s.EndpointCtrl
+	statusLayer *sync.SkaffoldStatusLayer
+}
+
+// Endpoint is the state of the endpoint with its watched pods, the changes of the paused
+// endpoint are buffered until it is resumed
+type Endpoint struct {
+	k8s.EndpointState
+	Paused   bool  `json:"paused"`
+	Buffered int   `json:"buffered"`
+	Pods     []Pod `json:"pods"`
+}
+
+type Pod struct {
+	Name            string   `json:"name"`
+	Phase           string   `json:"phase"`
+	CreatedAt       string   `json:"createdAt"`
+	IsTerminating   bool     `json:"terminating"`
+	ReadyContainers []string `json:"readyContainers"`
+}
+
+func NewEndpointsController(g *echo.Group, podsCtrl *k8s.EndpointCtrl, statusLayer *sync.SkaffoldStatusLayer) *EndpointsController {
+	ctrl := &EndpointsController{podsCtrl, statusLayer}
+
+	g.GET("", ctrl.listHandler())
+	g.PUT("/refresh", ctrl.refreshHandler())
+	g.GET("/:tag", ctrl.endpointHandler())
+	g.PUT("/:tag/pause", ctrl.pauseHandler())
+	g.PUT("/:tag/resume", ctrl.resumeHandler())
+
+	return ctrl
+}
+
+func (ctrl *EndpointsController) listHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(200, ctrl.endpoints())
+	}
+}
+
+func (ctrl *EndpointsController) endpointHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		for _, ep := range ctrl.endpoints() {
+			if ep.TagName == c.Param("tag") {
+				return c.JSON(200, ep)
+			}
+		}
+
+		return newError(404, CodeEndpointNotFound, fmt.Sprintf("endpoint %s not found", c.Param("tag")))
+	}
+}
+
+// refreshHandler resolves the pods of every endpoint anew, the changes are queued meanwhile
+func (ctrl *EndpointsController) refreshHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ctrl.podsCtrl.Rewatch(); err != nil {
+			return newError(502, CodeRefreshFailed, err.Error())
+		}
+
+		return c.JSON(200, newOKResponse())
+	}
+}
+
+func (ctrl *EndpointsController) pauseHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ctrl.statusLayer.Pause(c.Param("tag")); err != nil {
+			return newError(404, CodeEndpointNotFound, err.Error())
+		}
+
+		return c.JSON(200, newOKResponse())
+	}
+}
+
+func (ctrl *EndpointsController) resumeHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ctrl.statusLayer.Resume(c.Param("tag")); err != nil {
+			return newError(404, CodeEndpointNotFound, err.Error())
+		}
+
+		return c.JSON(200, newOKResponse())
+	}
+}
+
+func (ctrl *EndpointsController) endpoints() []Endpoint {
+	isPaused, pausedTags := ctrl.statusLayer.Paused()
+	buffered := ctrl.statusLayer.Buffered()
+
+	endpoints := make([]Endpoint, 0)
+	for _, state := range ctrl.podsCtrl.States() {
+		pods := make([]Pod, 0)
+		for _, pod := range ctrl.podsCtrl.Pods(state.TagName) {
+			pods = append(pods, podToView(pod))
+		}
+
+		endpoints = append(endpoints, Endpoint{
+			EndpointState: state,
+			Paused:        isPaused || pausedTags[state.TagName],
+			Buffered:      buffered[state.TagName],
+			Pods:          pods,
+		})
+	}
+
+	return endpoints
+}
+
+func podToView(pod cli.Pod) Pod {
+	readyContainers := make([]string, 0)
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			readyContainers = append(readyContainers, status.Name)
+		}
+	}
+
+	return Pod{
+		Name:            pod.Metadata.Name,
+		Phase:           pod.Status.Phase,
+		CreatedAt:       pod.Metadata.CreationTimestamp,
+		IsTerminating:   pod.Metadata.DeletionTimestamp != nil,
+		ReadyContainers: readyContainers,
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The codes of the error envelope, the clients match them instead of the messages
+const (
+	CodeInvalidParams      = "invalid_params"
+	CodeInvalidPath        = "invalid_path"
+	CodeUnauthorized       = "unauthorized"
+	CodeHostNotAllowed     = "host_not_allowed"
+	CodeOriginNotAllowed   = "origin_not_allowed"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeEndpointNotFound   = "endpoint_not_found"
+	CodePathNotFound       = "path_not_found"
+	CodeChangeListNotFound = "change_list_not_found"
+	CodeNoEndpoints        = "no_endpoints"
+	CodeSyncFailed         = "sync_failed"
+	CodeRefreshFailed      = "refresh_failed"
+	CodeInternal           = "internal"
+)
+
+// Error is returned by the handlers and the middlewares, it is rendered with its status as the envelope
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorEnvelope is the body of every error response, the sync responses add the results
+type ErrorEnvelope struct {
+	Error *Error `json:"error"`
+}
+
+// OKResponse is the body of the mutating handlers that have nothing else to answer
+type OKResponse struct {
+	Status string `json:"status"`
+}
+
+// FlushResponse adds the number of the flushed files by the endpoint tag
+type FlushResponse struct {
+	OKResponse
+	Flushed map[string]int `json:"flushed"`
+}
+
+func newOKResponse() OKResponse {
+	return OKResponse{Status: "OK"}
+}
+
+func newError(status int, code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Code, err.Message)
+}
+
+// errorHandler renders the errors of the handlers, the routing errors of echo and the
+// unexpected ones as the envelope
+func errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	apiErr, ok := err.(*Error)
+	if !ok {
+		apiErr = newError(http.StatusInternalServerError, CodeInternal, err.Error())
+
+		if httpErr, ok := err.(*echo.HTTPError); ok {
+			apiErr = newError(httpErr.Code, CodeInternal, fmt.Sprint(httpErr.Message))
+
+			switch httpErr.Code {
+			case http.StatusNotFound:
+				apiErr.Code = CodeNotFound
+			case http.StatusMethodNotAllowed:
+				apiErr.Code = CodeMethodNotAllowed
+			case http.StatusBadRequest:
+				apiErr.Code = CodeInvalidParams
+			}
+		}
+	}
+
+	if c.Request().Method == http.MethodHead {
+		_ = c.NoContent(apiErr.Status)
+		return
+	}
+
+	_ = c.JSON(apiErr.Status, ErrorEnvelope{apiErr})
+}
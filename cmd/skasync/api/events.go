@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"skasync/pkg/events"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// keepAlivePeriod is how often the idle stream gets a comment, so the proxies keep it open
+const keepAlivePeriod = 15 * time.Second
+
+type EventsController struct {
+	hub *events.Hub
+}
+
+func NewEventsController(g *echo.Group, hub *events.Hub) *EventsController {
+	ctrl := &EventsController{hub}
+
+	g.GET("", ctrl.streamHandler())
+
+	return ctrl
+}
+
+// streamHandler streams the events as Server-Sent Events. The stream resumes after the
+// Last-Event-ID header or the since query param, the kept events after it are sent first.
+// The event id is "<run>-<seq>", the stream of a restarted watcher is resumed from the start
+func (ctrl *EventsController) streamHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lastEventId := c.Request().Header.Get("Last-Event-ID")
+		if len(lastEventId) == 0 {
+			lastEventId = c.QueryParam("since")
+		}
+
+		missed := make([]events.Event, 0)
+		var ch chan events.Event
+		var cancel func()
+
+		if len(lastEventId) > 0 {
+			run, seq, err := parseEventId(lastEventId)
+			if err != nil {
+				return newError(400, CodeInvalidParams, "last event id must be the event id or seq")
+			}
+
+			missed, ch, cancel = ctrl.hub.SubscribeSince(run, seq)
+		} else {
+			ch, cancel = ctrl.hub.Subscribe()
+		}
+		defer cancel()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("Connection", "keep-alive")
+		res.WriteHeader(200)
+		res.Flush()
+
+		for _, e := range missed {
+			if err := writeEvent(res, e); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+
+		ticker := time.NewTicker(keepAlivePeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case e, ok := <-ch:
+				// The lagging stream is closed, the client reconnects with its last event id
+				if !ok {
+					return nil
+				}
+
+				if err := writeEvent(res, e); err != nil {
+					return nil
+				}
+				res.Flush()
+			case <-ticker.C:
+				if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case <-c.Request().Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(res, "id: %s-%d\nevent: %s\ndata: %s\n\n", e.Run, e.Seq, e.Type, data)
+
+	return err
+}
+
+// parseEventId splits the "<run>-<seq>" event id, the bare seq is of the current run
+func parseEventId(id string) (run string, seq uint64, err error) {
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		run, id = id[:i], id[i+1:]
+	}
+
+	seq, err = strconv.ParseUint(id, 10, 64)
+
+	return run, seq, err
+}
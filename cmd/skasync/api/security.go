@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The methods and the headers the browser pages of the allowed origins may send
+const (
+	preflightMethods = "GET, PUT, OPTIONS"
+	preflightHeaders = "Authorization, Content-Type, Last-Event-ID"
+)
+
+// eventsPath is the route of the events stream the events token is accepted for, see NewEventsController
+const eventsPath = "/events"
+
+// newToken generates the bearer token of the run
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// hostCheck rejects the requests to the other hosts, the pages of any domain resolved to
+// 127.0.0.1 (DNS rebinding) send their domain as the Host
+func hostCheck() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			host := c.Request().Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+
+			switch strings.Trim(host, "[]") {
+			case "localhost", "127.0.0.1", "::1":
+				return next(c)
+			}
+
+			return newError(403, CodeHostNotAllowed, fmt.Sprintf("host %s is not allowed", c.Request().Host))
+		}
+	}
+}
+
+// originCheck rejects the browser requests of the origins not listed in the config, the requests
+// without Origin are not sent by the browser pages. The preflight of the allowed origin is answered
+// here, before the token is checked, the browser never sends the token with it
+func originCheck(allowedOrigins []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			origin := c.Request().Header.Get(echo.HeaderOrigin)
+			if len(origin) == 0 {
+				return next(c)
+			}
+
+			for _, allowedOrigin := range allowedOrigins {
+				if origin == allowedOrigin {
+					c.Response().Header().Set(echo.HeaderAccessControlAllowOrigin, origin)
+					c.Response().Header().Set(echo.HeaderVary, echo.HeaderOrigin)
+
+					if isPreflight(c) {
+						c.Response().Header().Set(echo.HeaderAccessControlAllowMethods, preflightMethods)
+						c.Response().Header().Set(echo.HeaderAccessControlAllowHeaders, preflightHeaders)
+						c.Response().Header().Set(echo.HeaderAccessControlMaxAge, "600")
+						return c.NoContent(204)
+					}
+
+					return next(c)
+				}
+			}
+
+			return newError(403, CodeOriginNotAllowed, fmt.Sprintf("origin %s is not allowed", origin))
+		}
+	}
+}
+
+// isPreflight is true for the CORS preflight, the OPTIONS request asking for the method of the actual one
+func isPreflight(c echo.Context) bool {
+	return c.Request().Method == http.MethodOptions && len(c.Request().Header.Get(echo.HeaderAccessControlRequestMethod)) > 0
+}
+
+// tokenAuth requires the token as the bearer. The browser EventSource can't send the header, so
+// GET /events takes the events token as ?access_token= too. It only reads the events, the URL
+// with it may end up in the browser history and the logs
+func tokenAuth(token, eventsToken string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			given := strings.TrimPrefix(auth, "Bearer ")
+
+			if strings.HasPrefix(auth, "Bearer ") && isToken(given, token) {
+				return next(c)
+			}
+
+			if c.Request().Method == http.MethodGet && c.Request().URL.Path == eventsPath && isToken(c.QueryParam("access_token"), eventsToken) {
+				return next(c)
+			}
+
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+
+			return newError(401, CodeUnauthorized, "bearer token of the token file is required")
+		}
+	}
+}
+
+func isToken(given, token string) bool {
+	return len(given) > 0 && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"os"
+	"skasync/cmd/skasync/version"
+	"skasync/pkg/k8s"
+	"skasync/pkg/sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Status is the state of the running watcher, it is read by the status command
+type Status struct {
+	Watcher   WatcherStatus    `json:"watcher"`
+	Skaffold  SkaffoldStatus   `json:"skaffold"`
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+type WatcherStatus struct {
+	Version      string     `json:"version"`
+	PID          int        `json:"pid"`
+	StartedAt    time.Time  `json:"startedAt"`
+	LastChangeAt *time.Time `json:"lastChangeAt,omitempty"`
+	// IsPaused is true while syncing to all endpoints is paused
+	IsPaused bool `json:"paused"`
+	// ChangeLists are the debounced change batches, Syncs are the syncs of them to the endpoints
+	ChangeLists int `json:"changeLists"`
+	Syncs       int `json:"syncs"`
+	FailedSyncs int `json:"failedSyncs"`
+}
+
+type SkaffoldStatus struct {
+	IsWatching    bool            `json:"watching"`
+	IsReady       bool            `json:"ready"`
+	DoesNotAnswer bool            `json:"doesNotAnswer,omitempty"`
+	Deploy        string          `json:"deploy,omitempty"`
+	Artifacts     map[string]bool `json:"artifacts,omitempty"`
+}
+
+type EndpointStatus struct {
+	k8s.EndpointState
+	// Buffered is the count of the files queued until the endpoint is ready or resumed
+	Buffered int         `json:"buffered"`
+	IsPaused bool        `json:"paused"`
+	LastSync *SyncStatus `json:"lastSync,omitempty"`
+}
+
+type SyncStatus struct {
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Copied     int       `json:"copied"`
+	Deleted    int       `json:"deleted"`
+	Bytes      int64     `json:"bytes"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type StatusController struct {
+	podsCtrl    *k8s.EndpointCtrl
+	statusLayer *sync.SkaffoldStatusLayer
+	stats       *sync.Stats
+}
+
+func NewStatusController(g *echo.Group, podsCtrl *k8s.EndpointCtrl, statusLayer *sync.SkaffoldStatusLayer, stats *sync.Stats) *StatusController {
+	ctrl := &StatusController{
+		podsCtrl:    podsCtrl,
+		statusLayer: statusLayer,
+		stats:       stats,
+	}
+
+	g.GET("", ctrl.statusHandler())
+
+	return ctrl
+}
+
+func (ctrl *StatusController) statusHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(200, ctrl.Status())
+	}
+}
+
+func (ctrl *StatusController) Status() Status {
+	snapshot := ctrl.stats.Snapshot()
+	isWatching, skaffoldStatus := ctrl.statusLayer.Status()
+	buffered := ctrl.statusLayer.Buffered()
+	isPaused, pausedTags := ctrl.statusLayer.Paused()
+
+	status := Status{
+		Watcher: WatcherStatus{
+			Version:     version.VERSION,
+			PID:         os.Getpid(),
+			StartedAt:   snapshot.StartedAt,
+			IsPaused:    isPaused,
+			ChangeLists: snapshot.ChangeLists,
+			Syncs:       snapshot.Syncs,
+			FailedSyncs: snapshot.FailedSyncs,
+		},
+		Skaffold: SkaffoldStatus{
+			IsWatching:    isWatching,
+			IsReady:       skaffoldStatus.IsReady,
+			DoesNotAnswer: skaffoldStatus.DoesNotAnswer,
+			Deploy:        skaffoldStatus.Deploy,
+			Artifacts:     skaffoldStatus.ReadyArtifacts,
+		},
+		Endpoints: make([]EndpointStatus, 0),
+	}
+
+	if !snapshot.LastChangeAt.IsZero() {
+		status.Watcher.LastChangeAt = &snapshot.LastChangeAt
+	}
+
+	for _, state := range ctrl.podsCtrl.States() {
+		endpoint := EndpointStatus{
+			EndpointState: state,
+			Buffered:      buffered[state.TagName],
+			IsPaused:      isPaused || pausedTags[state.TagName],
+		}
+
+		if result, ok := snapshot.LastSyncs[state.TagName]; ok {
+			endpoint.LastSync = newSyncStatus(result)
+		}
+
+		status.Endpoints = append(status.Endpoints, endpoint)
+	}
+
+	return status
+}
+
+func newSyncStatus(result sync.SyncResult) *SyncStatus {
+	status := &SyncStatus{
+		StartedAt:  result.StartedAt,
+		DurationMs: result.Duration.Milliseconds(),
+		Copied:     result.Copied,
+		Deleted:    result.Deleted,
+		Bytes:      result.Bytes,
+	}
+
+	if result.Err != nil {
+		status.Error = result.Err.Error()
+	}
+
+	return status
+}
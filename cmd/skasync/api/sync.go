@@ -1,6 +1,9 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"skasync/pkg/k8s"
 	"skasync/pkg/sync"
 
@@ -8,22 +11,77 @@ import (
 )
 
 type SyncController struct {
-	podSyncer *sync.EndpointSyncker
-	podsCtrl  *k8s.EndpointCtrl
+	podSyncer   *sync.EndpointSyncker
+	podsCtrl    *k8s.EndpointCtrl
+	statusLayer *sync.SkaffoldStatusLayer
 }
 
-func NewSyncController(g *echo.Group, podSyncer *sync.EndpointSyncker, podsCtrl *k8s.EndpointCtrl) *SyncController {
+func NewSyncController(g *echo.Group, podSyncer *sync.EndpointSyncker, podsCtrl *k8s.EndpointCtrl, statusLayer *sync.SkaffoldStatusLayer) *SyncController {
 	ctrl := &SyncController{
-		podSyncer: podSyncer,
-		podsCtrl:  podsCtrl,
+		podSyncer:   podSyncer,
+		podsCtrl:    podsCtrl,
+		statusLayer: statusLayer,
 	}
 
 	g.PUT("/in/pod", ctrl.syncInHandler())
 	g.PUT("/in/allPods", ctrl.syncInToAllPodsHandler())
+	g.PUT("/pause", ctrl.pauseHandler())
+	g.PUT("/resume", ctrl.resumeHandler())
+	g.PUT("/flush", ctrl.flushHandler())
 
 	return ctrl
 }
 
+// pauseHandler buffers the changes of all endpoints until resumed
+func (ctrl *SyncController) pauseHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		_ = ctrl.statusLayer.Pause("")
+
+		return c.JSON(200, newOKResponse())
+	}
+}
+
+func (ctrl *SyncController) resumeHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		_ = ctrl.statusLayer.Resume("")
+
+		return c.JSON(200, newOKResponse())
+	}
+}
+
+// flushHandler syncs the buffered changes of the endpoints with a pod despite the pause and the skaffold deploy
+func (ctrl *SyncController) flushHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(200, FlushResponse{
+			OKResponse: newOKResponse(),
+			Flushed:    ctrl.statusLayer.Flush(),
+		})
+	}
+}
+
+// SyncResponse is the body of the sync responses, with the error envelope if any endpoint failed
+type SyncResponse struct {
+	Error   *Error               `json:"error,omitempty"`
+	Results []EndpointSyncResult `json:"results"`
+}
+
+// Sync statuses of the endpoints, the skipped endpoint has no pod to sync to, see Reason
+const (
+	EndpointSynced  = "synced"
+	EndpointFailed  = "failed"
+	EndpointSkipped = "skipped"
+)
+
+type EndpointSyncResult struct {
+	Tag    string `json:"tag"`
+	Pod    string `json:"pod,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	*SyncStatus
+	CopiedFiles  []string `json:"copiedFiles,omitempty"`
+	DeletedFiles []string `json:"deletedFiles,omitempty"`
+}
+
 func (ctrl *SyncController) syncInHandler() echo.HandlerFunc {
 	type data struct {
 		PodTag string `json:"podTag"`
@@ -32,29 +90,21 @@ func (ctrl *SyncController) syncInHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		reqData := data{}
 
-		if err := c.Bind(&reqData); err != nil {
-			return c.JSON(200, echo.Map{
-				"error": "incorect params",
-			})
+		if err := c.Bind(&reqData); err != nil || len(reqData.PodTag) == 0 || len(reqData.Path) == 0 {
+			return newError(400, CodeInvalidParams, "podTag and path are required")
 		}
 
 		pod, err := ctrl.podsCtrl.FindByTag(reqData.PodTag)
 		if err != nil {
-			return c.JSON(200, echo.Map{
-				"error": "pod not found",
-			})
+			return newError(404, CodeEndpointNotFound, fmt.Sprintf("endpoint %s not found or has no pod", reqData.PodTag))
 		}
 
-		if err := ctrl.podSyncer.SyncLocalPathToPod(pod, reqData.Path); err != nil {
-			return c.JSON(200, echo.Map{
-				"error":   "sync error",
-				"message": err.Error(),
-			})
+		result, err := ctrl.podSyncer.SyncLocalPathToPod(pod, reqData.Path)
+		if err != nil {
+			return pathError(reqData.Path, err)
 		}
 
-		return c.JSON(200, echo.Map{
-			"status": "OK",
-		})
+		return syncResponse(c, []sync.SyncResult{result}, nil)
 	}
 }
 
@@ -65,21 +115,82 @@ func (ctrl *SyncController) syncInToAllPodsHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		reqData := data{}
 
-		if err := c.Bind(&reqData); err != nil {
-			return c.JSON(200, echo.Map{
-				"error": "incorect params",
-			})
+		if err := c.Bind(&reqData); err != nil || len(reqData.Path) == 0 {
+			return newError(400, CodeInvalidParams, "path is required")
 		}
 
-		if err := ctrl.podSyncer.SyncLocalPathToPods(reqData.Path); err != nil {
-			return c.JSON(200, echo.Map{
-				"error":   "sync error",
-				"message": err.Error(),
-			})
+		results, err := ctrl.podSyncer.SyncLocalPathToPods(reqData.Path)
+		if err != nil {
+			return pathError(reqData.Path, err)
 		}
 
-		return c.JSON(200, echo.Map{
-			"status": "OK",
+		return syncResponse(c, results, ctrl.skippedEndpoints())
+	}
+}
+
+// skippedEndpoints returns the endpoints without a pod with the reason
+func (ctrl *SyncController) skippedEndpoints() []EndpointSyncResult {
+	skipped := make([]EndpointSyncResult, 0)
+	for _, state := range ctrl.podsCtrl.States() {
+		if len(state.PodName) > 0 {
+			continue
+		}
+
+		skipped = append(skipped, EndpointSyncResult{
+			Tag:    state.TagName,
+			Status: EndpointSkipped,
+			Reason: state.Reason,
 		})
 	}
+
+	return skipped
+}
+
+// syncResponse responds 502 with the error envelope if the sync to any endpoint failed, and 409
+// if every endpoint is skipped. The skipped endpoints follow the synced ones
+func syncResponse(c echo.Context, results []sync.SyncResult, skipped []EndpointSyncResult) error {
+	res := SyncResponse{Results: make([]EndpointSyncResult, 0, len(results)+len(skipped))}
+
+	failed := 0
+	for _, result := range results {
+		status := EndpointSynced
+		if result.Err != nil {
+			status = EndpointFailed
+			failed++
+		}
+
+		res.Results = append(res.Results, EndpointSyncResult{
+			Tag:          result.TagName,
+			Pod:          result.Location,
+			Status:       status,
+			SyncStatus:   newSyncStatus(result),
+			CopiedFiles:  result.CopiedFiles,
+			DeletedFiles: result.DeletedFiles,
+		})
+	}
+
+	res.Results = append(res.Results, skipped...)
+
+	if len(results) == 0 {
+		res.Error = newError(409, CodeNoEndpoints, "no endpoint has a pod")
+		return c.JSON(res.Error.Status, res)
+	}
+
+	if failed > 0 {
+		res.Error = newError(502, CodeSyncFailed, fmt.Sprintf("sync to %d of %d endpoints failed", failed, len(results)))
+		return c.JSON(res.Error.Status, res)
+	}
+
+	return c.JSON(200, res)
+}
+
+func pathError(localPath string, err error) error {
+	switch {
+	case errors.Is(err, sync.ErrPathOutsideRoot):
+		return newError(400, CodeInvalidPath, fmt.Sprintf("%s: %s", localPath, err))
+	case errors.Is(err, os.ErrNotExist):
+		return newError(404, CodePathNotFound, fmt.Sprintf("path %s not found", localPath))
+	}
+
+	return err
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"skasync/cmd/skasync/version"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// legacyFlags are the long flags which were set with a single dash, e.g. -context
+var legacyFlags = map[string]struct{}{"context": {}, "ns": {}, "debug": {}, "profile": {}, "force": {}}
+
+// newRootCommand builds the command tree, the global flags are shared by every command
+func newRootCommand() *cobra.Command {
+	flagsCfg := &flagsConfig{}
+
+	root := &cobra.Command{
+		Use:   "skasync",
+		Short: "Skasync quickly syncs files to Kubernetes pods for a development environment",
+		// The usage is printed for the wrong flags and args only, not for the errors of the run
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.SilenceUsage = true
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVarP(&flagsCfg.ConfigFilePath, "config", "c", "", "Config file (default skasync.config.{json,jsonc,yaml,yml} of the current dir)")
+	flags.StringVar(&flagsCfg.Context, "context", "", "Kube context, overrides the config")
+	flags.StringVar(&flagsCfg.Namespace, "ns", "", "Kube namespace, overrides the config")
+	flags.StringVar(&flagsCfg.Profiles, "profile", "", "Comma-separated list of config profiles")
+	flags.BoolVar(&flagsCfg.IsDebug, "debug", false, "Print the collected changes")
+
+	root.AddCommand(
+		newWatcherCommand(flagsCfg),
+		newSyncCommand(flagsCfg),
+		newMappingsCommand(flagsCfg),
+		newImportCommand(flagsCfg),
+		newConfigCommand(flagsCfg),
+		newInitCommand(flagsCfg),
+		newStatusCommand(flagsCfg),
+		newVersionCommand(),
+	)
+
+	return root
+}
+
+func newWatcherCommand(flagsCfg *flagsConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "watcher",
+		Short: "Watch the working directory and sync the changes to the endpoints",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(WatcherMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			RunWatcher(cfg)
+
+			return nil
+		},
+	}
+}
+
+func newSyncCommand(flagsCfg *flagsConfig) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Copy the paths between the working directory and the endpoints once",
+	}
+
+	inArgs := SyncInArgs{}
+	inCmd := &cobra.Command{
+		Use:   "in",
+		Short: "Copy the paths of the working directory to the endpoints",
+		Example: "  skasync sync in --all --path src,config\n" +
+			"  skasync sync in --endpoint api --endpoint worker --path src",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(SyncMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			cfg.SyncArgs = SyncArgs{SyncDiraction: InSyncDiraction, SyncInArgs: inArgs}
+
+			return RunSync(cfg)
+		},
+	}
+
+	inCmd.Flags().StringSliceVarP(&inArgs.Pods, "endpoint", "e", nil, "Endpoints to copy to, comma-separated or repeated")
+	inCmd.Flags().BoolVar(&inArgs.IsAllPods, "all", false, "Copy to every endpoint of the config")
+	inCmd.Flags().StringSliceVarP(&inArgs.Paths, "path", "p", nil, "Paths within the working directory, comma-separated or repeated")
+	inCmd.MarkFlagsOneRequired("endpoint", "all")
+	inCmd.MarkFlagsMutuallyExclusive("endpoint", "all")
+	_ = inCmd.MarkFlagRequired("path")
+	_ = inCmd.RegisterFlagCompletionFunc("endpoint", completeEndpoints(flagsCfg))
+
+	outCmd := &cobra.Command{
+		Use:   "out",
+		Short: "Copy the paths of the endpoints to the working directory (not implemented)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return errors.New("sync out is not implemented")
+		},
+	}
+
+	cmd.AddCommand(inCmd, outCmd)
+
+	return cmd
+}
+
+func newMappingsCommand(flagsCfg *flagsConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "mappings",
+		Short: "Print the local to container path mappings of every artifact",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(MappingsMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			RunMappings(cfg)
+
+			return nil
+		},
+	}
+}
+
+func newImportCommand(flagsCfg *flagsConfig) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Generate the config from another tool's config",
+	}
+
+	args := ImportArgs{Source: "skaffold"}
+	skaffoldCmd := &cobra.Command{
+		Use:   "skaffold",
+		Short: "Generate the config from the artifacts and the kubectl manifests of skaffold.yaml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, _, err := newConfig(ImportMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			if !filepath.IsAbs(args.SkaffoldFilePath) {
+				args.SkaffoldFilePath = filepath.Join(cfg.RootDir, args.SkaffoldFilePath)
+			}
+
+			if args.OutputFilePath != "-" && !filepath.IsAbs(args.OutputFilePath) {
+				args.OutputFilePath = filepath.Join(cfg.RootDir, args.OutputFilePath)
+			}
+
+			cfg.ImportArgs = args
+
+			RunImport(cfg)
+
+			return nil
+		},
+	}
+
+	skaffoldCmd.Flags().StringVarP(&args.SkaffoldFilePath, "file", "f", "skaffold.yaml", "Skaffold config file")
+	skaffoldCmd.Flags().StringSliceVarP(&args.Profiles, "profiles", "p", nil, "Comma-separated list of skaffold profiles")
+	skaffoldCmd.Flags().StringVarP(&args.OutputFilePath, "output", "o", "skasync.config.json", "Output file (- for stdout)")
+	skaffoldCmd.Flags().BoolVar(&args.IsForce, "force", false, "Overwrite existing output file")
+
+	cmd.AddCommand(skaffoldCmd)
+
+	return cmd
+}
+
+func newConfigCommand(flagsCfg *flagsConfig) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Check, describe and print the config",
+	}
+
+	// The validate and schema commands report the problems of the file themselves
+	runFileCommand := func(command string) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := newConfig(ConfigMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			cfg.ConfigArgs.Command = command
+
+			RunConfig(cfg)
+
+			return nil
+		}
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   ConfigValidateCommand,
+			Short: "Report every problem of the config file with its position",
+			Args:  cobra.NoArgs,
+			RunE:  runFileCommand(ConfigValidateCommand),
+		},
+		&cobra.Command{
+			Use:   ConfigSchemaCommand,
+			Short: "Print the JSON Schema of the config",
+			Args:  cobra.NoArgs,
+			RunE:  runFileCommand(ConfigSchemaCommand),
+		},
+		&cobra.Command{
+			Use:   ConfigPrintCommand,
+			Short: "Print the effective config with the profiles, the local file and the overrides applied",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := LoadConfig(ConfigMode, flagsCfg)
+				if err != nil {
+					return err
+				}
+
+				cfg.ConfigArgs.Command = ConfigPrintCommand
+
+				RunConfig(cfg)
+
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+func newInitCommand(flagsCfg *flagsConfig) *cobra.Command {
+	args := InitArgs{}
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Propose the config from the Dockerfiles of the working directory and the running pods",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, _, err := newConfig(InitMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			if args.OutputFilePath != "-" && !filepath.IsAbs(args.OutputFilePath) {
+				args.OutputFilePath = filepath.Join(cfg.RootDir, args.OutputFilePath)
+			}
+
+			args.Context = flagsCfg.Context
+			args.Namespace = flagsCfg.Namespace
+			cfg.InitArgs = args
+
+			RunInit(cfg)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&args.OutputFilePath, "output", "o", "skasync.config.json", "Output file (- for stdout)")
+	cmd.Flags().BoolVarP(&args.IsYes, "yes", "y", false, "Accept every proposal without the questions")
+	cmd.Flags().BoolVar(&args.IsForce, "force", false, "Overwrite existing output file")
+
+	return cmd
+}
+
+func newStatusCommand(flagsCfg *flagsConfig) *cobra.Command {
+	args := StatusArgs{}
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the endpoints, the skaffold readiness and the last syncs of the running watcher",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := LoadConfig(StatusMode, flagsCfg)
+			if err != nil {
+				return err
+			}
+
+			if args.Interval <= 0 {
+				return errors.New("--interval must be positive")
+			}
+
+			cfg.StatusArgs = args
+
+			RunStatus(cfg)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&args.IsWatch, "watch", "w", false, "Refresh the view until interrupted")
+	cmd.Flags().DurationVar(&args.Interval, "interval", 2*time.Second, "Refresh interval of --watch")
+
+	return cmd
+}
+
+func newVersionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print the version",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("Version: v%s\n", version.VERSION)
+		},
+	}
+}
+
+// completeEndpoints completes the endpoint tags of the config
+func completeEndpoints(flagsCfg *flagsConfig) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cfg, err := LoadConfig(SyncMode, flagsCfg)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		tags := make([]string, 0, len(cfg.Endpoints))
+		for tagName := range cfg.Endpoints {
+			if strings.HasPrefix(tagName, toComplete) {
+				tags = append(tags, tagName)
+			}
+		}
+		sort.Strings(tags)
+
+		return tags, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// normalizeArgs turns the single dash long flags into the double dash ones, the args after -- are kept
+func normalizeArgs(args []string) []string {
+	normalized := make([]string, 0, len(args))
+
+	for i, arg := range args {
+		if arg == "--" {
+			return append(normalized, args[i:]...)
+		}
+
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") {
+			name := strings.SplitN(arg[1:], "=", 2)[0]
+			if _, ok := legacyFlags[name]; ok {
+				arg = "-" + arg
+			}
+		}
+
+		normalized = append(normalized, arg)
+	}
+
+	return normalized
+}
@@ -1,27 +1,38 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"skasync/cmd/skasync/api"
+	"skasync/pkg/config"
 	"skasync/pkg/docker"
+	"skasync/pkg/git"
 	"skasync/pkg/k8s"
 	"skasync/pkg/skaffold"
 	"skasync/pkg/sync"
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
 
 const (
-	WatcherMode = "watcher"
-	SyncMode    = "sync"
-	VersionMode = "version"
+	WatcherMode  = "watcher"
+	SyncMode     = "sync"
+	VersionMode  = "version"
+	MappingsMode = "mappings"
+	ImportMode   = "import"
+	ConfigMode   = "config"
+	InitMode     = "init"
+	StatusMode   = "status"
+)
+
+const (
+	ConfigValidateCommand = "validate"
+	ConfigSchemaCommand   = "schema"
+	ConfigPrintCommand    = "print"
 )
 
 const (
@@ -33,14 +44,28 @@ type Config struct {
 	Context,
 	Namespace,
 	RootDir string
-	Mode      string
-	IsDebug   bool
 	Artifacts map[string]docker.ArtifactConfig
 	Endpoints map[string]k8s.EndpointConfig
+	Discovery k8s.DiscoveryConfig
 	Sync      sync.Config
 	Skaffold  skaffold.Config
+	Git       git.Config
 	API       api.Config
-	SyncArgs  SyncArgs
+	// Named partial configs merged over the file by --profile, see readConfigDocument
+	Profiles map[string]Config `json:",omitempty"`
+
+	// The command line state, it is not read from the config file
+	Mode           string     `json:"-"`
+	IsDebug        bool       `json:"-"`
+	ConfigFilePath string     `json:"-"`
+	ActiveProfiles []string   `json:"-"`
+	SyncArgs       SyncArgs   `json:"-"`
+	ImportArgs     ImportArgs `json:"-"`
+	ConfigArgs     ConfigArgs `json:"-"`
+	InitArgs       InitArgs   `json:"-"`
+	StatusArgs     StatusArgs `json:"-"`
+	// flags are kept to load the config again, see reloadConfig
+	flags *flagsConfig
 }
 
 type SyncArgs struct {
@@ -57,230 +82,385 @@ type SyncInArgs struct {
 
 type SyncOutArgs struct{}
 
-type envConfig struct {
+type ImportArgs struct {
+	Source,
+	SkaffoldFilePath,
+	OutputFilePath string
+	Profiles []string
+	IsForce  bool
+}
+
+type ConfigArgs struct {
+	Command string
+}
+
+type InitArgs struct {
+	OutputFilePath,
+	// Kube context and namespace to look for the pods in, the current ones if empty
 	Context,
 	Namespace string
+	// Accepts every proposal without the questions
+	IsYes   bool
+	IsForce bool
+}
+
+type StatusArgs struct {
+	// Refreshes the view every Interval until interrupted
+	IsWatch  bool
+	Interval time.Duration
+}
+
+type envConfig struct {
+	Context,
+	Namespace,
+	// Comma-separated list of profiles
+	Profile string
 }
 
 type flagsConfig struct {
 	Context,
 	Namespace,
-	ConfigFilePath string
+	ConfigFilePath,
+	Profiles string
 	IsDebug bool
 }
 
-func LoadConfig() (*Config, error) {
-	currentDirPath, _ := os.Getwd()
-
-	cfg := defaultConfig(currentDirPath)
-
-	err := readEnvs(&cfg)
+// LoadConfig applies the config sources in the order: defaults, the config file, the selected
+// profiles, the local file, ${ENV} interpolation, SKASYNC_* environment variables, the flags
+func LoadConfig(mode string, flagsCfg *flagsConfig) (*Config, error) {
+	cfg, envCfg, err := newConfig(mode, flagsCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	err = readMode(&cfg)
-	if err != nil {
+	if err := readFile(cfg, cfg.ConfigFilePath); err != nil {
 		return nil, err
 	}
 
-	if cfg.Mode == VersionMode {
-		return &cfg, nil
+	applyOverrides(cfg, envCfg, flagsCfg)
+
+	if mode == MappingsMode || mode == ConfigMode {
+		return cfg, docker.CheckArtifactsCfg(cfg.Artifacts)
 	}
 
-	flagsCfg, err := readFlags(cfg.Mode, currentDirPath)
-	if err != nil {
+	// The status is read from the running watcher, only the API section is needed
+	if mode == StatusMode {
+		return cfg, nil
+	}
+
+	if err := checkConfig(cfg); err != nil {
 		return nil, err
 	}
 
+	return cfg, nil
+}
+
+// newConfig returns the defaults with the command line state, the config file is not read
+func newConfig(mode string, flagsCfg *flagsConfig) (*Config, envConfig, error) {
+	currentDirPath, _ := os.Getwd()
+
+	cfg := defaultConfig(currentDirPath)
+	cfg.Mode = mode
 	cfg.IsDebug = flagsCfg.IsDebug
+	cfg.flags = flagsCfg
 
-	err = readFile(&cfg, flagsCfg.ConfigFilePath)
+	envCfg, err := readEnvs()
 	if err != nil {
-		return nil, err
+		return nil, envCfg, err
 	}
 
-	if cfg.Mode == SyncMode {
-		err = readSyncArgs(&cfg)
-		if err != nil {
-			return nil, err
-		}
+	cfg.ConfigFilePath = flagsCfg.ConfigFilePath
+	if len(cfg.ConfigFilePath) == 0 {
+		cfg.ConfigFilePath = defaultConfigFilePath(currentDirPath)
+	}
+
+	if !filepath.IsAbs(cfg.ConfigFilePath) {
+		cfg.ConfigFilePath = filepath.Join(currentDirPath, cfg.ConfigFilePath)
+	}
+
+	profiles := envCfg.Profile
+	if len(flagsCfg.Profiles) > 0 {
+		profiles = flagsCfg.Profiles
+	}
+
+	if len(profiles) > 0 {
+		cfg.ActiveProfiles = strings.Split(profiles, ",")
+	}
+
+	return &cfg, envCfg, nil
+}
+
+// reloadConfig reads the config file again with the command line state of prev
+func reloadConfig(prev *Config) (*Config, error) {
+	return LoadConfig(prev.Mode, prev.flags)
+}
+
+// applyOverrides applies the environment variables and then the flags over the config file
+func applyOverrides(cfg *Config, envCfg envConfig, flagsCfg *flagsConfig) {
+	if len(envCfg.Context) > 0 {
+		cfg.Context = envCfg.Context
+	}
+
+	if len(envCfg.Namespace) > 0 {
+		cfg.Namespace = envCfg.Namespace
 	}
 
-	if len(cfg.Context) == 0 {
+	if len(flagsCfg.Context) > 0 {
 		cfg.Context = flagsCfg.Context
 	}
 
-	if len(cfg.Namespace) == 0 {
+	if len(flagsCfg.Namespace) > 0 {
 		cfg.Namespace = flagsCfg.Namespace
 	}
+}
 
-	if len(cfg.Context) == 0 {
-		return nil, errors.New("undefined context")
-	}
+// checkConfig checks the endpoints and the artifacts the watcher and sync modes use
+func checkConfig(cfg *Config) error {
+	// The global context and namespace are required by the endpoints that don't override them
+	for tagName, ep := range cfg.Endpoints {
+		if len(cfg.Context) == 0 && len(ep.Context) == 0 {
+			return fmt.Errorf("undefined context of endpoint %s", tagName)
+		}
+
+		if len(cfg.Namespace) == 0 && len(ep.Namespace) == 0 {
+			return fmt.Errorf("undefined namespace of endpoint %s", tagName)
+		}
 
-	if len(cfg.Namespace) == 0 {
-		return nil, errors.New("undefined namespace")
+		if _, ok := cfg.Artifacts[ep.Artifact]; !ok {
+			return fmt.Errorf("artifact %s of endpoint %s is undefined", ep.Artifact, tagName)
+		}
 	}
 
-	if len(cfg.Endpoints) == 0 {
-		return nil, errors.New("undefined endpoints")
+	if cfg.Discovery.Enabled {
+		if len(cfg.Context) == 0 || len(cfg.Namespace) == 0 {
+			return errors.New("endpoints discovery requires the global context and namespace")
+		}
+	} else if len(cfg.Endpoints) == 0 {
+		return errors.New("undefined endpoints")
 	}
 
 	if err := k8s.CheckEndpointsCfg(cfg.Endpoints); err != nil {
-		return nil, err
+		return err
 	}
 
-	if err := docker.CheckArtifactsCfg(cfg.Artifacts); err != nil {
-		return nil, err
+	if cfg.API.Port < 0 || cfg.API.Port > 65535 {
+		return fmt.Errorf("API port %d is out of range", cfg.API.Port)
 	}
 
-	return &cfg, nil
+	if err := skaffold.CheckConfig(cfg.Skaffold); err != nil {
+		return err
+	}
+
+	if err := sync.CheckConfig(cfg.Sync); err != nil {
+		return err
+	}
+
+	return docker.CheckArtifactsCfg(cfg.Artifacts)
 }
 
 func defaultConfig(rootDirPath string) Config {
 	return Config{
 		Sync:     sync.DefaultConfig(),
 		Skaffold: skaffold.DefaultConfig(),
+		Git:      git.DefaultConfig(),
 		API:      api.DefaultConfig(),
 		RootDir:  rootDirPath,
 		IsDebug:  false,
 	}
 }
 
-func readFlags(mode, rootDirPath string) (*flagsConfig, error) {
-	cfg := &flagsConfig{}
+func readEnvs() (envConfig, error) {
+	envCfg := envConfig{}
+
+	err := envconfig.Process("skasync", &envCfg)
+
+	return envCfg, err
+}
 
-	argBais := 2
-	for i, arg := range os.Args {
-		if arg[0] == '-' {
-			argBais = i
-			break
+// defaultConfigFilePath returns the first existing skasync.config file of the supported
+// extensions, skasync.config.json if there is none
+func defaultConfigFilePath(rootDirPath string) string {
+	for _, ext := range config.Extensions {
+		configPath := filepath.Join(rootDirPath, "skasync.config"+ext)
+		if _, err := os.Stat(configPath); err == nil {
+			return configPath
 		}
 	}
 
-	configPath := filepath.Join(rootDirPath, "skasync.config.json")
+	return filepath.Join(rootDirPath, "skasync.config.json")
+}
+
+func readFile(cfg *Config, configFilePath string) error {
+	currentPath, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if !filepath.IsAbs(configFilePath) {
+		configFilePath = filepath.Join(currentPath, configFilePath)
+	}
 
-	flagSet := flag.NewFlagSet("config", flag.ContinueOnError)
+	doc, err := readConfigDocument(configFilePath, cfg.ActiveProfiles)
+	if err != nil {
+		return err
+	}
 
-	flagSet.StringVar(&cfg.ConfigFilePath, "c", configPath, "Config file")
-	flagSet.StringVar(&cfg.Context, "context", "", "Using kubctl context")
-	flagSet.StringVar(&cfg.Namespace, "ns", "", "Using kubctl namespace")
-	flagSet.BoolVar(&cfg.IsDebug, "debug", false, "Set debug mode")
+	if err := doc.Decode(cfg); err != nil {
+		return err
+	}
 
-	flagSet.Parse(os.Args[argBais:])
+	configFileDir := filepath.Dir(configFilePath)
 
-	if !filepath.IsAbs(cfg.ConfigFilePath) {
-		cfg.ConfigFilePath = filepath.Join(rootDirPath, cfg.ConfigFilePath)
+	if !filepath.IsAbs(cfg.RootDir) {
+		cfg.RootDir = filepath.Join(configFileDir, cfg.RootDir)
 	}
 
-	return cfg, nil
-}
+	if _, err := os.Stat(cfg.RootDir); os.IsNotExist(err) {
+		return fmt.Errorf("root dir \"%s\" is undefined", cfg.RootDir)
+	}
 
-func readMode(cfg *Config) error {
-	if len(os.Args) < 2 {
-		return errors.New("mode not found")
+	if len(cfg.Skaffold.ConfigFile) > 0 {
+		if err := readSkaffoldFile(cfg); err != nil {
+			return err
+		}
 	}
 
-	mode := os.Args[1]
+	for i, artifact := range cfg.Artifacts {
+		if len(artifact.Context) > 0 && !filepath.IsAbs(artifact.Context) {
+			artifact.Context = filepath.Join(cfg.RootDir, artifact.Context)
+			cfg.Artifacts[i] = artifact
+		}
 
-	switch mode {
-	case WatcherMode:
-		cfg.Mode = WatcherMode
-	case SyncMode:
-		cfg.Mode = SyncMode
-	case VersionMode:
-		cfg.Mode = VersionMode
-	default:
-		return errors.New("undefined mode: " + mode)
+		if filepath.IsAbs(artifact.DockerfileDir) {
+			continue
+		}
+
+		artifact.DockerfileDir = filepath.Join(cfg.RootDir, artifact.DockerfileDir)
+		if _, err := os.Stat(artifact.DockerfileDir); os.IsNotExist(err) {
+			return fmt.Errorf("artifact (image \"%s\") dockerfile path \"%s\" is undefined", artifact.Image, artifact.DockerfileDir)
+		}
+
+		cfg.Artifacts[i] = artifact
 	}
 
 	return nil
 }
 
-func readEnvs(cfg *Config) error {
-	envCfg := envConfig{}
-
-	err := envconfig.Process("skasync", &envCfg)
+// readConfigDocument reads the config file with the selected profiles and the local file merged over it,
+// the environment variables are interpolated
+func readConfigDocument(configFilePath string, profiles []string) (*config.Document, error) {
+	doc, local, err := loadConfigFiles(configFilePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(envCfg.Context) > 0 {
-		cfg.Context = envCfg.Context
+	if err := applyConfigLayers(doc, local, profiles); err != nil {
+		return nil, err
 	}
 
-	if len(envCfg.Namespace) > 0 {
-		cfg.Namespace = envCfg.Namespace
+	if issues := doc.Interpolate(os.LookupEnv); len(issues) > 0 {
+		return nil, issues[0]
 	}
 
-	return nil
+	return doc, nil
 }
 
-func readSyncArgs(cfg *Config) error {
-	if len(os.Args) < 4 {
-		return errors.New("args length error")
+// loadConfigFiles reads the config file and the untracked local file next to it, local is nil if there is none
+func loadConfigFiles(configFilePath string) (doc, local *config.Document, err error) {
+	doc, err = config.Load(configFilePath)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	switch os.Args[2] {
-	case "in":
-		pods := os.Args[3]
-		if pods == "all" {
-			cfg.SyncArgs.SyncInArgs.IsAllPods = true
-		} else {
-			cfg.SyncArgs.SyncInArgs.Pods = strings.Split(pods, ",")
+	for _, ext := range config.Extensions {
+		localFilePath := filepath.Join(filepath.Dir(configFilePath), "skasync.local"+ext)
+		if _, err := os.Stat(localFilePath); err != nil {
+			continue
+		}
+
+		local, err = config.Load(localFilePath)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		cfg.SyncArgs.SyncInArgs.Paths = strings.Split(os.Args[4], ",")
-	case "out":
-	default:
-		return fmt.Errorf("sync diraction %s is undefined", os.Args[2])
+		break
 	}
 
-	return nil
+	return doc, local, nil
 }
 
-func readFile(cfg *Config, configFilePath string) error {
-	currentPath, err := os.Getwd()
-	if err != nil {
-		return err
+// applyConfigLayers merges the profiles in the given order and the local file over the document.
+// A profile is defined in the config or the local file, the local definition is merged over the other
+func applyConfigLayers(doc, local *config.Document, profiles []string) error {
+	definitions := []*config.Document{doc}
+	if local != nil {
+		definitions = append(definitions, local)
 	}
 
-	if !filepath.IsAbs(configFilePath) {
-		configFilePath = filepath.Join(currentPath, configFilePath)
+	for _, name := range profiles {
+		isFound := false
+		for _, definition := range definitions {
+			node := definition.Lookup("Profiles", name)
+			if node == nil {
+				continue
+			}
+
+			doc.Merge(definition.FilePath, node)
+			isFound = true
+		}
+
+		if !isFound {
+			return doc.Errorf(doc.Lookup("Profiles"), "profile %s is undefined", name)
+		}
 	}
 
-	fileData, err := ioutil.ReadFile(configFilePath)
-	if err != nil {
-		return err
+	if local != nil {
+		doc.Merge(local.FilePath, local.Root)
 	}
 
-	err = json.Unmarshal(fileData, cfg)
+	doc.Delete("Profiles")
+
+	return nil
+}
+
+// readSkaffoldFile adds the artifacts and endpoints of skaffold.yaml which are not defined in the config file
+func readSkaffoldFile(cfg *Config) error {
+	skaffoldFilePath := cfg.Skaffold.ConfigFile
+	if !filepath.IsAbs(skaffoldFilePath) {
+		skaffoldFilePath = filepath.Join(cfg.RootDir, skaffoldFilePath)
+	}
+
+	result, err := skaffold.Import(skaffoldFilePath, cfg.Skaffold.Profiles)
 	if err != nil {
 		return err
 	}
 
-	configFileDir := filepath.Dir(configFilePath)
-
-	if !filepath.IsAbs(cfg.RootDir) {
-		cfg.RootDir = filepath.Join(configFileDir, cfg.RootDir)
-	}
+	skaffoldDir := filepath.Dir(skaffoldFilePath)
 
-	if _, err := os.Stat(cfg.RootDir); os.IsNotExist(err) {
-		return fmt.Errorf("root dir \"%s\" is undefined", cfg.RootDir)
+	if cfg.Artifacts == nil {
+		cfg.Artifacts = make(map[string]docker.ArtifactConfig)
 	}
 
-	for i, artifact := range cfg.Artifacts {
-		if filepath.IsAbs(artifact.DockerfileDir) {
+	for id, artifact := range result.Artifacts {
+		if _, exist := cfg.Artifacts[id]; exist {
 			continue
 		}
 
-		artifact.DockerfileDir = filepath.Join(cfg.RootDir, artifact.DockerfileDir)
-		if _, err := os.Stat(artifact.DockerfileDir); os.IsNotExist(err) {
-			return fmt.Errorf("artifact (image \"%s\") dockerfile path \"%s\" is undefined", artifact.Image, artifact.DockerfileDir)
+		artifact.Context = filepath.Join(skaffoldDir, artifact.Context)
+		artifact.DockerfileDir = filepath.Join(skaffoldDir, artifact.DockerfileDir)
+		cfg.Artifacts[id] = artifact
+	}
+
+	if cfg.Endpoints == nil {
+		cfg.Endpoints = make(map[string]k8s.EndpointConfig)
+	}
+
+	for name, endpoint := range result.Endpoints {
+		if _, exist := cfg.Endpoints[name]; exist {
+			continue
 		}
 
-		cfg.Artifacts[i] = artifact
+		cfg.Endpoints[name] = endpoint
 	}
 
 	return nil
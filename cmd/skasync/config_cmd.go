@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"skasync/pkg/config"
+	"skasync/pkg/docker"
+	"skasync/pkg/k8s"
+	"skasync/pkg/sync"
+	"sort"
+)
+
+// RunConfig runs the config command: validate reports all problems of the config file,
+// schema prints the JSON Schema of the config, print prints the effective config
+func RunConfig(cfg *Config) {
+	switch cfg.ConfigArgs.Command {
+	case ConfigValidateCommand:
+		issues := validateConfigFile(cfg.ConfigFilePath, cfg.ActiveProfiles)
+		if len(issues) == 0 {
+			fmt.Printf("%s is valid\n", cfg.ConfigFilePath)
+			return
+		}
+
+		for _, issue := range issues {
+			fmt.Fprintln(os.Stderr, issue.Error())
+		}
+
+		os.Exit(1)
+	case ConfigSchemaCommand:
+		data, err := json.MarshalIndent(configSchema(), "", "    ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(data))
+	case ConfigPrintCommand:
+		data, err := json.MarshalIndent(cfg, "", "    ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(data))
+	}
+}
+
+func configSchema() map[string]interface{} {
+	return config.Schema("skasync config", Config{})
+}
+
+// validateConfigFile collects the problems of the config and local files with their positions,
+// it doesn't stop at the first one
+func validateConfigFile(configFilePath string, profiles []string) []config.Issue {
+	doc, local, err := loadConfigFiles(configFilePath)
+	if err != nil {
+		if issue, ok := err.(config.Issue); ok {
+			return []config.Issue{issue}
+		}
+
+		return []config.Issue{{FilePath: configFilePath, Message: err.Error()}}
+	}
+
+	// Every file is checked before the merge, so the unused profiles are checked as well
+	issues := doc.CheckKeys(&Config{})
+	if local != nil {
+		issues = append(issues, local.CheckKeys(&Config{})...)
+	}
+
+	if err := applyConfigLayers(doc, local, profiles); err != nil {
+		issue := config.Issue{}
+		if !errors.As(err, &issue) {
+			issue = doc.Issue(nil, err.Error())
+		}
+
+		issues = append(issues, issue)
+		config.SortIssues(issues)
+		return issues
+	}
+
+	issues = append(issues, doc.Interpolate(os.LookupEnv)...)
+
+	// The values of a wrong type are skipped by the decoding and reported with the positions above,
+	// the checks below go on with what is decoded
+	cfg := defaultConfig(filepath.Dir(configFilePath))
+	if err := doc.Decode(&cfg); err != nil {
+		typeErr := &json.UnmarshalTypeError{}
+		if !errors.As(err, &typeErr) {
+			issues = append(issues, doc.Issue(nil, err.Error()))
+		}
+	}
+
+	if !filepath.IsAbs(cfg.RootDir) {
+		cfg.RootDir = filepath.Join(filepath.Dir(configFilePath), cfg.RootDir)
+	}
+
+	// The paths relative to the missing root dir are not checked
+	hasRootDir := true
+	if _, err := os.Stat(cfg.RootDir); err != nil {
+		hasRootDir = false
+		issues = append(issues, doc.Issue(doc.Lookup("RootDir"), fmt.Sprintf("root dir \"%s\" doesn't exist", cfg.RootDir)))
+	}
+
+	if err := sync.CheckConfig(cfg.Sync); err != nil {
+		issues = append(issues, doc.Issue(doc.Lookup("Sync", "Debounce"), err.Error()))
+	}
+
+	artifactIds := make([]string, 0, len(cfg.Artifacts))
+	for id := range cfg.Artifacts {
+		artifactIds = append(artifactIds, id)
+	}
+	sort.Strings(artifactIds)
+
+	for _, id := range artifactIds {
+		artifact := cfg.Artifacts[id]
+		node := doc.Lookup("Artifacts", id)
+
+		if err := docker.CheckArtifactsCfg(map[string]docker.ArtifactConfig{id: artifact}); err != nil {
+			issues = append(issues, doc.Issue(node, fmt.Sprintf("artifact %s requires Image", id)))
+		}
+
+		dockerfileDir := artifact.DockerfileDir
+		if !filepath.IsAbs(dockerfileDir) {
+			if !hasRootDir {
+				continue
+			}
+
+			dockerfileDir = filepath.Join(cfg.RootDir, dockerfileDir)
+		}
+
+		if _, err := os.Stat(dockerfileDir); err != nil {
+			valueNode := doc.Lookup("Artifacts", id, "DockerfileDir")
+			if valueNode == nil {
+				valueNode = node
+			}
+
+			issues = append(issues, doc.Issue(valueNode, fmt.Sprintf("artifact %s DockerfileDir \"%s\" doesn't exist", id, dockerfileDir)))
+		}
+	}
+
+	// The artifacts and endpoints of skaffold.yaml have no position in the config file
+	if len(cfg.Skaffold.ConfigFile) > 0 && (hasRootDir || filepath.IsAbs(cfg.Skaffold.ConfigFile)) {
+		if err := readSkaffoldFile(&cfg); err != nil {
+			issues = append(issues, doc.Issue(doc.Lookup("Skaffold", "ConfigFile"), err.Error()))
+		}
+	}
+
+	tags := make([]string, 0, len(cfg.Endpoints))
+	for tagName := range cfg.Endpoints {
+		tags = append(tags, tagName)
+	}
+	sort.Strings(tags)
+
+	for _, tagName := range tags {
+		ep := cfg.Endpoints[tagName]
+		node := doc.Lookup("Endpoints", tagName)
+
+		if len(ep.Artifact) > 0 {
+			if _, ok := cfg.Artifacts[ep.Artifact]; !ok {
+				valueNode := doc.Lookup("Endpoints", tagName, "Artifact")
+				if valueNode == nil {
+					valueNode = node
+				}
+
+				issues = append(issues, doc.Issue(valueNode, fmt.Sprintf("endpoint %s references unknown artifact \"%s\"", tagName, ep.Artifact)))
+			}
+		}
+
+		if err := k8s.CheckEndpointsCfg(map[string]k8s.EndpointConfig{tagName: ep}); err != nil {
+			issues = append(issues, doc.Issue(node, fmt.Sprintf("endpoint %s: %s", tagName, err)))
+		}
+	}
+
+	config.SortIssues(issues)
+
+	return issues
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"skasync/pkg/docker"
+	"skasync/pkg/skaffold"
+)
+
+type importedArtifact struct {
+	Image         string
+	Context       string `json:",omitempty"`
+	DockerfileDir string
+	Dockerfile    string            `json:",omitempty"`
+	BuildArgs     map[string]string `json:",omitempty"`
+	Sync          []docker.SyncRule `json:",omitempty"`
+}
+
+type importedEndpoint struct {
+	Artifact,
+	Selector,
+	Container string
+	Namespace string `json:",omitempty"`
+}
+
+type importedConfig struct {
+	RootDir   string
+	Artifacts map[string]importedArtifact
+	Endpoints map[string]importedEndpoint
+}
+
+// RunImport writes the skasync config generated from skaffold.yaml
+func RunImport(cfg *Config) {
+	args := cfg.ImportArgs
+
+	result, err := skaffold.Import(args.SkaffoldFilePath, args.Profiles)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Paths in the result are relative to skaffold.yaml, so it becomes the working directory
+	rootDir := filepath.Dir(args.SkaffoldFilePath)
+	if args.OutputFilePath != "-" {
+		rootDir, err = filepath.Rel(filepath.Dir(args.OutputFilePath), rootDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	out := importedConfig{
+		RootDir:   filepath.ToSlash(rootDir),
+		Artifacts: make(map[string]importedArtifact),
+		Endpoints: make(map[string]importedEndpoint),
+	}
+
+	for id, artifact := range result.Artifacts {
+		out.Artifacts[id] = importedArtifact{
+			Image:         artifact.Image,
+			Context:       filepath.ToSlash(artifact.Context),
+			DockerfileDir: filepath.ToSlash(artifact.DockerfileDir),
+			Dockerfile:    artifact.Dockerfile,
+			BuildArgs:     artifact.BuildArgs,
+			Sync:          artifact.Sync,
+		}
+	}
+
+	for name, endpoint := range result.Endpoints {
+		out.Endpoints[name] = importedEndpoint{
+			Artifact:  endpoint.Artifact,
+			Selector:  endpoint.Selector,
+			Container: endpoint.Container,
+			Namespace: endpoint.Namespace,
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if args.OutputFilePath == "-" {
+		fmt.Println(string(data))
+		return
+	}
+
+	if _, err := os.Stat(args.OutputFilePath); err == nil && !args.IsForce {
+		log.Fatalf("file \"%s\" already exists, use -force to overwrite", args.OutputFilePath)
+	}
+
+	if err := ioutil.WriteFile(args.OutputFilePath, append(data, '\n'), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Imported %d artifacts and %d endpoints to %s\n", len(out.Artifacts), len(out.Endpoints), args.OutputFilePath)
+
+	if len(out.Endpoints) == 0 {
+		fmt.Println("No endpoints found in kubectl manifests, add them to the config manually")
+	}
+}
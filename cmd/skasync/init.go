@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"skasync/pkg/cli"
+	"skasync/pkg/docker"
+	"skasync/pkg/sync"
+	"sort"
+	"strings"
+)
+
+// initArtifact is the artifact proposed for the found Dockerfile, the paths are relative to the root dir
+type initArtifact struct {
+	Id,
+	Image,
+	Context,
+	DockerfileDir,
+	Dockerfile string
+	HasDockerignore bool
+}
+
+// initEndpoint is the endpoint proposed for the container running the artifact image
+type initEndpoint struct {
+	Tag,
+	Artifact,
+	Selector,
+	Container,
+	PodName,
+	Image string
+}
+
+// RunInit writes the config proposed from the Dockerfiles of the working directory and
+// the pods running their images, every proposal is confirmed unless -y is set
+func RunInit(cfg *Config) {
+	args := cfg.InitArgs
+
+	if args.OutputFilePath != "-" {
+		if _, err := os.Stat(args.OutputFilePath); err == nil && !args.IsForce {
+			log.Fatalf("file \"%s\" already exists, use -force to overwrite", args.OutputFilePath)
+		}
+	}
+
+	// The questions must not get into the config printed to stdout
+	out := io.Writer(os.Stdout)
+	if args.OutputFilePath == "-" {
+		out = os.Stderr
+	}
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: out, isYes: args.IsYes}
+
+	found, err := findDockerfiles(cfg.RootDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintf(out, "Found %d Dockerfiles in %s\n", len(found), cfg.RootDir)
+
+	kubeCtl := cli.NewKubeCtl(cli.NewCLI(args.Context, args.Namespace))
+
+	kubeContext := args.Context
+	if len(kubeContext) == 0 {
+		if kubeContext, err = kubeCtl.CurrentContext(); err != nil {
+			fmt.Fprintf(out, "\033[33mKube context is not found:\033[0m %s\n", err)
+		}
+	}
+
+	namespace := args.Namespace
+	if len(namespace) == 0 {
+		if namespace, err = kubeCtl.CurrentNamespace(); err != nil {
+			fmt.Fprintf(out, "\033[33mNamespace is not found:\033[0m %s\n", err)
+		}
+	}
+
+	pods, err := cli.NewKubeCtl(cli.NewCLI(kubeContext, namespace)).GetPods("")
+	if err != nil {
+		fmt.Fprintf(out, "\033[33mPods are not listed, the endpoints are not proposed:\033[0m %s\n", err)
+	} else {
+		fmt.Fprintf(out, "Found %d pods in %s/%s\n", len(pods), kubeContext, namespace)
+	}
+
+	artifacts := make([]initArtifact, 0, len(found))
+	for _, artifact := range found {
+		image := guessImage(artifact.Id, pods)
+		if len(image) == 0 {
+			image = artifact.Id
+		}
+
+		question := fmt.Sprintf("Image of artifact %s (%s), - to skip", artifact.Id, filepath.ToSlash(artifact.dockerfilePath()))
+		if artifact.Image = p.ask(question, image); artifact.Image == "-" {
+			continue
+		}
+
+		artifacts = append(artifacts, artifact)
+	}
+
+	endpoints := make([]initEndpoint, 0)
+	for _, endpoint := range proposeEndpoints(artifacts, pods) {
+		question := fmt.Sprintf("Add endpoint %s (container %s of %s, selector %s)?", endpoint.Tag, endpoint.Container, endpoint.PodName, endpoint.Selector)
+		if p.confirm(question) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	rootDir := "."
+	if args.OutputFilePath != "-" {
+		if rootDir, err = filepath.Rel(filepath.Dir(args.OutputFilePath), cfg.RootDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	data := renderInitConfig(filepath.ToSlash(rootDir), kubeContext, namespace, artifacts, endpoints)
+
+	if args.OutputFilePath == "-" {
+		fmt.Print(data)
+		return
+	}
+
+	if err := ioutil.WriteFile(args.OutputFilePath, []byte(data), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Written %d artifacts and %d endpoints to %s\n", len(artifacts), len(endpoints), args.OutputFilePath)
+
+	if len(endpoints) == 0 {
+		fmt.Println("No endpoints are added, add them to the config manually")
+	}
+
+	fmt.Printf("Check the config with: skasync config validate -c %s\n", args.OutputFilePath)
+}
+
+func (a initArtifact) dockerfilePath() string {
+	if len(a.Dockerfile) == 0 {
+		return path.Join(a.DockerfileDir, docker.DockerfileName)
+	}
+
+	return path.Join(a.DockerfileDir, a.Dockerfile)
+}
+
+// findDockerfiles walks the root dir skipping the hidden and the dependency dirs. The build context
+// is the nearest dir of the Dockerfile or above it having .dockerignore, the Dockerfile dir if there is none
+func findDockerfiles(rootDir string) ([]initArtifact, error) {
+	artifacts := make([]initArtifact, 0)
+	ids := make(map[string]struct{})
+
+	err := filepath.Walk(rootDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if info.IsDir() {
+			if filePath != rootDir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !isDockerfileName(name) {
+			return nil
+		}
+
+		dir := filepath.Dir(filePath)
+		contextDir, hasDockerignore := findDockerignoreDir(rootDir, dir)
+
+		artifact := initArtifact{
+			Id:              artifactIdOf(rootDir, dir, name, ids),
+			Context:         relSlashPath(rootDir, contextDir),
+			DockerfileDir:   relSlashPath(rootDir, dir),
+			HasDockerignore: hasDockerignore,
+		}
+
+		if name != docker.DockerfileName {
+			artifact.Dockerfile = name
+		}
+
+		ids[artifact.Id] = struct{}{}
+		artifacts = append(artifacts, artifact)
+
+		return nil
+	})
+
+	return artifacts, err
+}
+
+func isDockerfileName(name string) bool {
+	if name == docker.DockerfileName {
+		return true
+	}
+
+	if strings.HasSuffix(name, ".dockerignore") {
+		return false
+	}
+
+	return strings.HasPrefix(name, docker.DockerfileName+".") || strings.HasSuffix(strings.ToLower(name), ".dockerfile")
+}
+
+func findDockerignoreDir(rootDir, dir string) (string, bool) {
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, err := os.Stat(filepath.Join(current, ".dockerignore")); err == nil {
+			return current, true
+		}
+
+		if current == rootDir || current == filepath.Dir(current) {
+			return dir, false
+		}
+	}
+}
+
+// genericDirNames are the dirs of the Dockerfiles named after their parent dir, e.g. web/docker
+var genericDirNames = map[string]struct{}{"docker": {}, "build": {}, "deploy": {}, "dockerfiles": {}}
+
+// artifactIdOf names the artifact by its dir, the Dockerfile.dev or dev.Dockerfile name adds -dev.
+// The dir path is used if the name is taken
+func artifactIdOf(rootDir, dir, name string, ids map[string]struct{}) string {
+	suffix := ""
+	if strings.HasPrefix(name, docker.DockerfileName+".") {
+		suffix = name[len(docker.DockerfileName)+1:]
+	} else if strings.HasSuffix(strings.ToLower(name), ".dockerfile") {
+		suffix = name[:len(name)-len(".dockerfile")]
+	}
+
+	id := strings.ToLower(filepath.Base(dir))
+	if _, ok := genericDirNames[id]; ok && dir != rootDir {
+		id = strings.ToLower(filepath.Base(filepath.Dir(dir)))
+	}
+
+	if len(suffix) > 0 {
+		id += "-" + strings.ToLower(suffix)
+	}
+
+	if _, ok := ids[id]; !ok {
+		return id
+	}
+
+	id = strings.ToLower(strings.ReplaceAll(relSlashPath(rootDir, dir), "/", "-"))
+	if len(suffix) > 0 {
+		id += "-" + strings.ToLower(suffix)
+	}
+
+	return id
+}
+
+// guessImage returns the running image named as the artifact, the empty string if there is none
+func guessImage(id string, pods []cli.Pod) string {
+	images := make([]string, 0)
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			images = append(images, docker.ImageName(container.Image))
+		}
+	}
+
+	sort.Strings(images)
+
+	for _, image := range images {
+		if path.Base(image) == id {
+			return image
+		}
+	}
+
+	for _, image := range images {
+		name := path.Base(image)
+		if strings.Contains(name, id) || strings.Contains(id, name) {
+			return image
+		}
+	}
+
+	return ""
+}
+
+// proposeEndpoints returns an endpoint for every workload container running an artifact image,
+// the endpoints are named as the discovery names them
+func proposeEndpoints(artifacts []initArtifact, pods []cli.Pod) []initEndpoint {
+	endpoints := make([]initEndpoint, 0)
+	tags := make(map[string]struct{})
+
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Metadata.Name < pods[j].Metadata.Name
+	})
+
+	for _, pod := range pods {
+		selector := podSelector(pod.Metadata.Labels)
+		if len(selector) == 0 {
+			continue
+		}
+
+		for _, container := range pod.Spec.Containers {
+			for _, artifact := range artifacts {
+				if !docker.IsSameImage(container.Image, artifact.Image, "") {
+					continue
+				}
+
+				tag := pod.WorkloadName()
+				if len(pod.Spec.Containers) > 1 {
+					tag += "-" + container.Name
+				}
+
+				if _, ok := tags[tag]; ok {
+					break
+				}
+
+				tags[tag] = struct{}{}
+				endpoints = append(endpoints, initEndpoint{
+					Tag:       tag,
+					Artifact:  artifact.Id,
+					Selector:  selector,
+					Container: container.Name,
+					PodName:   pod.Metadata.Name,
+					Image:     container.Image,
+				})
+
+				break
+			}
+		}
+	}
+
+	return endpoints
+}
+
+// podSelector prefers the well-known app labels, the other labels but the ones
+// generated by the workloads are used otherwise
+func podSelector(labels map[string]string) string {
+	if name, ok := labels["app.kubernetes.io/name"]; ok {
+		if instance, ok := labels["app.kubernetes.io/instance"]; ok {
+			return "app.kubernetes.io/name=" + name + ",app.kubernetes.io/instance=" + instance
+		}
+
+		return "app.kubernetes.io/name=" + name
+	}
+
+	for _, key := range []string{"app", "k8s-app", "name", "component"} {
+		if value, ok := labels[key]; ok {
+			return key + "=" + value
+		}
+	}
+
+	parts := make([]string, 0, len(labels))
+	for key, value := range labels {
+		switch key {
+		case "pod-template-hash", "controller-revision-hash", "pod-template-generation", "statefulset.kubernetes.io/pod-name":
+			continue
+		}
+
+		parts = append(parts, key+"="+value)
+	}
+
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+// renderInitConfig writes the config as JSON with comments, skasync reads it from .json as well
+func renderInitConfig(rootDir, kubeContext, namespace string, artifacts []initArtifact, endpoints []initEndpoint) string {
+	b := strings.Builder{}
+
+	b.WriteString("{\n")
+	b.WriteString("    // Generated by skasync init. Check the changes with `skasync config validate`,\n")
+	b.WriteString("    // `skasync config schema` lists all the options\n")
+	fmt.Fprintf(&b, "    \"Context\": %s,\n", jsonString(kubeContext))
+	fmt.Fprintf(&b, "    \"Namespace\": %s,\n", jsonString(namespace))
+	fmt.Fprintf(&b, "    \"RootDir\": %s,\n", jsonString(rootDir))
+
+	b.WriteString("    \"Artifacts\": {\n")
+	for i, a := range artifacts {
+		contextDir := "the Dockerfile dir"
+		if a.HasDockerignore {
+			contextDir = "the dir of .dockerignore"
+		}
+
+		fmt.Fprintf(&b, "        // %s, the build context is %s. The sync mappings are inferred\n", a.dockerfilePath(), contextDir)
+		b.WriteString("        // from the final stage of the Dockerfile, see `skasync mappings`\n")
+
+		fields := []string{
+			jsonField("Image", a.Image),
+			jsonField("Context", a.Context),
+			jsonField("DockerfileDir", a.DockerfileDir),
+		}
+		if len(a.Dockerfile) > 0 {
+			fields = append(fields, jsonField("Dockerfile", a.Dockerfile))
+		}
+
+		writeJSONObject(&b, a.Id, fields, i < len(artifacts)-1)
+	}
+	b.WriteString("    },\n")
+
+	b.WriteString("    \"Endpoints\": {\n")
+	if len(endpoints) == 0 {
+		b.WriteString("        // No pods of the artifacts found, an endpoint is the container the artifact is synced to:\n")
+		b.WriteString("        // \"app\": { \"Artifact\": \"app\", \"Selector\": \"app=app\", \"Container\": \"app\" }\n")
+	}
+
+	for i, e := range endpoints {
+		fmt.Fprintf(&b, "        // Pod %s runs %s\n", e.PodName, e.Image)
+
+		fields := []string{
+			jsonField("Artifact", e.Artifact),
+			jsonField("Selector", e.Selector),
+			jsonField("Container", e.Container),
+		}
+
+		writeJSONObject(&b, e.Tag, fields, i < len(endpoints)-1)
+	}
+	b.WriteString("    },\n")
+
+	b.WriteString("    \"Sync\": {\n")
+	b.WriteString("        // Milliseconds the changes are collected for before the sync\n")
+	fmt.Fprintf(&b, "        \"Debounce\": %d\n", sync.DefaultConfig().Debounce)
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func writeJSONObject(b *strings.Builder, key string, fields []string, hasNext bool) {
+	fmt.Fprintf(b, "        %s: {\n", jsonString(key))
+	b.WriteString("            " + strings.Join(fields, ",\n            ") + "\n")
+
+	if hasNext {
+		b.WriteString("        },\n")
+	} else {
+		b.WriteString("        }\n")
+	}
+}
+
+func jsonField(key, value string) string {
+	return jsonString(key) + ": " + jsonString(value)
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func relSlashPath(rootDir, dir string) string {
+	rel, err := filepath.Rel(rootDir, dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// prompter asks the questions on the terminal, the default answers are taken if isYes is set or stdin is over
+type prompter struct {
+	in    *bufio.Reader
+	out   io.Writer
+	isYes bool
+}
+
+func (p *prompter) ask(question, value string) string {
+	if p.isYes {
+		return value
+	}
+
+	fmt.Fprintf(p.out, "%s [%s]: ", question, value)
+
+	if answer := p.read(); len(answer) > 0 {
+		return answer
+	}
+
+	return value
+}
+
+func (p *prompter) confirm(question string) bool {
+	if p.isYes {
+		return true
+	}
+
+	fmt.Fprintf(p.out, "%s [Y/n]: ", question)
+
+	switch strings.ToLower(p.read()) {
+	case "n", "no":
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *prompter) read() string {
+	answer, err := p.in.ReadString('\n')
+	if err != nil {
+		// Nobody is answering, the rest is taken by default
+		fmt.Fprintln(p.out)
+		p.isYes = true
+	}
+
+	return strings.TrimSpace(answer)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"skasync/pkg/docker"
+	"sort"
+)
+
+// RunMappings prints local -> remote path mappings of every artifact
+func RunMappings(cfg *Config) {
+	artifactService := docker.NewArtifactService(cfg.RootDir)
+
+	if err := artifactService.Load(cfg.Artifacts); err != nil {
+		log.Fatal(err)
+	}
+
+	ids := make([]string, 0, len(cfg.Artifacts))
+	for id := range cfg.Artifacts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		artifact, err := artifactService.FindById(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Artifact \"%s\" (image %s)\n", id, artifact.Image)
+
+		if len(artifact.RootDir) > 0 {
+			fmt.Printf("\t. -> %s/ (RootDir from config)\n", artifact.RootDir)
+			continue
+		}
+
+		if rules := artifact.SyncRules(); len(rules) > 0 {
+			fmt.Printf("\tmanual sync rules (context %s)\n", artifact.ContextDir)
+			for _, rule := range rules {
+				fmt.Printf("\t%s\n", rule)
+			}
+			continue
+		}
+
+		fmt.Printf("\tinferred from %s (context %s)\n", cfg.Artifacts[id].DockerfilePath(), artifact.ContextDir)
+		for _, mapping := range artifact.SyncMappings() {
+			fmt.Printf("\t%s\n", mapping)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"skasync/pkg/config"
+	"skasync/pkg/docker"
+	"skasync/pkg/filemon"
+	"skasync/pkg/k8s"
+	"sort"
+	"time"
+
+	"github.com/rjeczalik/notify"
+)
+
+// reloadDebounce waits for the editor to finish writing the config file
+const reloadDebounce = 500 * time.Millisecond
+
+// configReloader applies the changed config file to the running watcher. The endpoints, the artifacts
+// and the debounce are changed live, the other changes require a restart. The invalid config is
+// rejected and the last good one keeps running
+type configReloader struct {
+	cfg *Config
+
+	artifactService *docker.ArtifactService
+	endpointsCtrl   *k8s.EndpointCtrl
+	gateway         *filemon.Gateway
+	watcher         *filemon.Watcher
+}
+
+func newConfigReloader(cfg *Config, artifactService *docker.ArtifactService, endpointsCtrl *k8s.EndpointCtrl, gateway *filemon.Gateway, watcher *filemon.Watcher) *configReloader {
+	return &configReloader{
+		cfg:             cfg,
+		artifactService: artifactService,
+		endpointsCtrl:   endpointsCtrl,
+		gateway:         gateway,
+		watcher:         watcher,
+	}
+}
+
+// Listen watches the directory of the config file, the local file next to it is watched as well
+func (cr *configReloader) Listen(ctx context.Context) error {
+	c := make(chan notify.EventInfo, 100)
+	defer notify.Stop(c)
+
+	if err := notify.Watch(filepath.Dir(cr.cfg.ConfigFilePath), c, notify.All); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(1<<63 - 1)
+	for {
+		select {
+		case e := <-c:
+			if cr.isConfigFile(e.Path()) {
+				timer.Reset(reloadDebounce)
+			}
+		case <-timer.C:
+			cr.reload()
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+func (cr *configReloader) isConfigFile(filePath string) bool {
+	if filepath.Clean(filePath) == filepath.Clean(cr.cfg.ConfigFilePath) {
+		return true
+	}
+
+	for _, ext := range config.Extensions {
+		if filepath.Base(filePath) == "skasync.local"+ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cr *configReloader) reload() {
+	cfg, err := reloadConfig(cr.cfg)
+	if err != nil {
+		fmt.Printf("\033[31mConfig reload rejected, the previous config keeps running:\033[0m %s\n", err)
+		return
+	}
+
+	changedArtifacts, err := cr.artifactService.Update(cfg.Artifacts)
+	if err != nil {
+		fmt.Printf("\033[31mConfig reload rejected, the previous config keeps running:\033[0m %s\n", err)
+		return
+	}
+
+	cr.endpointsCtrl.Update(cfg.Endpoints, changedArtifacts)
+
+	if cfg.Sync.Debounce != cr.cfg.Sync.Debounce {
+		cr.gateway.SetDebounce(cfg.Sync.Debounce)
+		cr.watcher.SetDebounce(cfg.Sync.Debounce)
+	}
+
+	if fields := restartRequiredFields(cr.cfg, cfg); len(fields) > 0 {
+		fmt.Printf("\033[33mConfig changes of %v are applied after restart\033[0m\n", fields)
+	}
+
+	cr.cfg = cfg
+
+	println("Config is reloaded")
+}
+
+// restartRequiredFields returns the changed config sections that can't be changed live
+func restartRequiredFields(prev, cfg *Config) []string {
+	prevSync, sync := prev.Sync, cfg.Sync
+	prevSync.Debounce, sync.Debounce = 0, 0
+
+	fields := make([]string, 0)
+	for name, isChanged := range map[string]bool{
+		"Context":   prev.Context != cfg.Context,
+		"Namespace": prev.Namespace != cfg.Namespace,
+		"RootDir":   prev.RootDir != cfg.RootDir,
+		"Discovery": !reflect.DeepEqual(prev.Discovery, cfg.Discovery),
+		"Sync":      !reflect.DeepEqual(prevSync, sync),
+		"Skaffold":  !reflect.DeepEqual(prev.Skaffold, cfg.Skaffold),
+		"API":       !reflect.DeepEqual(prev.API, cfg.API),
+	} {
+		if isChanged {
+			fields = append(fields, name)
+		}
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
@@ -1,27 +1,14 @@
 package main
 
 import (
-	"fmt"
-	"log"
 	"os"
-	"skasync/cmd/skasync/version"
 )
 
 func main() {
-	cfg, err := LoadConfig()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if cfg.Mode == VersionMode {
-		fmt.Printf("Version: v%s\n", version.VERSION)
-		os.Exit(0)
-	}
+	root := newRootCommand()
+	root.SetArgs(normalizeArgs(os.Args[1:]))
 
-	if cfg.Mode == WatcherMode {
-		RunWatcher(cfg)
-		return
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
 	}
-
-	RunSync(cfg)
 }
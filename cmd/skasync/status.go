@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"skasync/cmd/skasync/api"
+	"skasync/pkg/k8s"
+	"skasync/pkg/util"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RunStatus prints the state of the running watcher, with --watch the view is refreshed until interrupted
+func RunStatus(cfg *Config) {
+	if !cfg.StatusArgs.IsWatch {
+		status, err := fetchStatus(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		printStatus(status)
+		return
+	}
+
+	for {
+		// The discovery file is read anew, the watcher may be restarted meanwhile
+		status, err := fetchStatus(cfg)
+
+		// Clears the screen and moves the cursor home
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("\033[37mEvery %s, %s\033[0m\n\n", cfg.StatusArgs.Interval, time.Now().Format("15:04:05"))
+
+		if err != nil {
+			fmt.Printf("\033[31m%s\033[0m\n", err)
+		} else {
+			printStatus(status)
+		}
+
+		time.Sleep(cfg.StatusArgs.Interval)
+	}
+}
+
+func fetchStatus(cfg *Config) (api.Status, error) {
+	status := api.Status{}
+
+	client, err := api.NewClient(cfg.API, cfg.RootDir, 5*time.Second)
+	if err != nil {
+		return status, err
+	}
+
+	if err := client.GetJSON("/status", &status); err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+func printStatus(status api.Status) {
+	w := status.Watcher
+	fmt.Printf("Watcher v%s (pid %d), up %s", w.Version, w.PID, sinceReadable(w.StartedAt))
+	if w.LastChangeAt != nil {
+		fmt.Printf(", last change %s ago", sinceReadable(*w.LastChangeAt))
+	}
+	fmt.Printf("\n\t%d change lists, %d syncs", w.ChangeLists, w.Syncs)
+	if w.FailedSyncs > 0 {
+		fmt.Printf(", \033[31m%d failed\033[0m", w.FailedSyncs)
+	}
+	if w.IsPaused {
+		fmt.Print(", \033[33msyncing is paused\033[0m")
+	}
+	fmt.Print("\n\n")
+
+	printSkaffoldStatus(status.Skaffold)
+	fmt.Println()
+
+	if len(status.Endpoints) == 0 {
+		fmt.Println("No endpoints")
+		return
+	}
+
+	fmt.Println("Endpoints:")
+	for _, ep := range status.Endpoints {
+		printEndpointStatus(ep)
+	}
+}
+
+func printSkaffoldStatus(status api.SkaffoldStatus) {
+	switch {
+	case !status.IsWatching:
+		fmt.Println("Skaffold: \033[37mnot watched\033[0m")
+		return
+	case status.DoesNotAnswer:
+		fmt.Println("Skaffold: \033[31mnot answering\033[0m")
+		return
+	case status.IsReady:
+		fmt.Println("Skaffold: \033[32mready\033[0m")
+	default:
+		fmt.Printf("Skaffold: \033[33mnot ready\033[0m \033[37m(deploy %s)\033[0m\n", status.Deploy)
+	}
+
+	images := make([]string, 0, len(status.Artifacts))
+	for image := range status.Artifacts {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+
+	for _, image := range images {
+		if status.Artifacts[image] {
+			fmt.Printf("\t\033[32mready\033[0m     %s\n", image)
+		} else {
+			fmt.Printf("\t\033[33mbuilding\033[0m  %s\n", image)
+		}
+	}
+}
+
+func printEndpointStatus(ep api.EndpointStatus) {
+	state := fmt.Sprintf("\033[33m%s\033[0m", ep.State)
+	if ep.State == k8s.EndpointStateReady {
+		state = fmt.Sprintf("\033[32m%s\033[0m", ep.State)
+	}
+	if ep.IsPaused {
+		state += " \033[33mPaused\033[0m"
+	}
+
+	fmt.Printf("  %s %s \033[37m(artifact %s, %s/%s)\033[0m\n", ep.TagName, state, ep.Artifact, ep.Context, ep.Namespace)
+
+	if len(ep.PodName) > 0 {
+		containers := ep.SyncContainers
+		if len(containers) == 0 {
+			containers = ep.Containers
+		}
+		fmt.Printf("\tpod %s [%s]\n", ep.PodName, strings.Join(containers, ", "))
+	}
+
+	if len(ep.Reason) > 0 {
+		fmt.Printf("\t\033[37m%s\033[0m\n", ep.Reason)
+	}
+
+	if ep.Buffered > 0 {
+		fmt.Printf("\t\033[33m%d files are queued\033[0m\n", ep.Buffered)
+	}
+
+	lastSync := ep.LastSync
+	if lastSync == nil {
+		fmt.Println("\tno syncs yet")
+		return
+	}
+
+	fmt.Printf(
+		"\tlast sync %s ago, %dms, \033[33m-%d ~%d\033[0m files, %s",
+		sinceReadable(lastSync.StartedAt), lastSync.DurationMs, lastSync.Deleted, lastSync.Copied, util.LenReadable(int(lastSync.Bytes), 2),
+	)
+	if len(lastSync.Error) > 0 {
+		fmt.Printf(", \033[31mfailed:\033[0m %s", lastSync.Error)
+	}
+	fmt.Println()
+}
+
+func sinceReadable(t time.Time) string {
+	return time.Since(t).Round(time.Second).String()
+}
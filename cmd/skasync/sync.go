@@ -1,8 +1,8 @@
 package main
 
 import (
-	"context"
-	"log"
+	"errors"
+	"fmt"
 	"skasync/pkg/cli"
 	"skasync/pkg/docker"
 	"skasync/pkg/filesystem"
@@ -16,44 +16,45 @@ import (
 // skasync sync -> * to/path
 // skasync sync <- podName to/path
 // find * -type f
-func RunSync(cfg *Config) {
-	mainCtx := context.Background()
+func RunSync(cfg *Config) error {
+	if cfg.SyncArgs.SyncDiraction != InSyncDiraction {
+		return errors.New("sync out is not implemented")
+	}
 
-	ccli := cli.NewCLI(cfg.Context, cfg.Namespace)
-	kubeCtl := cli.NewKubeCtl(ccli)
+	cliPool := cli.NewPool(cfg.Context, cfg.Namespace)
 	artifactService := docker.NewArtifactService(cfg.RootDir)
-	podsCtrl := k8s.NewEndpointsCtrl(cfg.RootDir, cfg.Endpoints, kubeCtl, artifactService)
+	podsCtrl := k8s.NewEndpointsCtrl(cfg.RootDir, cfg.Endpoints, cfg.Discovery, cliPool, artifactService)
 	refFilesMapService := filesystem.NewFilesMapService(cfg.RootDir)
-	podSyncker := sync.NewEndpointSyncker(cfg.RootDir, ccli, podsCtrl, refFilesMapService)
+	podSyncker := sync.NewEndpointSyncker(cfg.RootDir, podsCtrl, refFilesMapService, cfg.Sync.DebugContainer)
 
 	if err := artifactService.Load(cfg.Artifacts); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	if err := podsCtrl.Refresh(); err != nil {
-		log.Fatal(err)
-	}
-
-	if cfg.SyncArgs.SyncDiraction == InSyncDiraction {
-		inSyncDiraction(mainCtx, cfg.SyncArgs, podsCtrl, podSyncker)
-		return
+		return err
 	}
 
-	outSyncDiraction(mainCtx)
+	return inSyncDiraction(cfg.SyncArgs, podsCtrl, podSyncker)
 }
 
-func inSyncDiraction(ctx context.Context, cfg SyncArgs, podsCtrl *k8s.EndpointCtrl, podSyncker *sync.EndpointSyncker) {
+// inSyncDiraction copies the paths to the endpoints, the error is returned if any endpoint has failed
+func inSyncDiraction(cfg SyncArgs, podsCtrl *k8s.EndpointCtrl, podSyncker *sync.EndpointSyncker) error {
 	var pods []*k8s.Endpoint
 
 	if cfg.SyncInArgs.IsAllPods {
+		// The endpoints without a pod are reported by the refresh and skipped
 		pods = podsCtrl.GetPods()
+		if len(pods) == 0 {
+			return errors.New("no endpoint has a pod to sync to")
+		}
 	} else {
 		pods = make([]*k8s.Endpoint, 0, len(cfg.SyncInArgs.Pods))
 
 		for _, podArg := range cfg.SyncInArgs.Pods {
 			pod, err := podsCtrl.FindByTag(podArg)
 			if err != nil {
-				log.Fatal(err)
+				return fmt.Errorf("endpoint %s: %w", podArg, err)
 			}
 
 			pods = append(pods, pod)
@@ -71,12 +72,10 @@ func inSyncDiraction(ctx context.Context, cfg SyncArgs, podsCtrl *k8s.EndpointCt
 		}
 	}()
 
-	podSyncker.SyncLocalPathsToPods(pods, cfg.SyncInArgs.Paths, progressCh)
+	err := podSyncker.SyncLocalPathsToPods(pods, cfg.SyncInArgs.Paths, progressCh)
 
 	bar.Finish()
 	// fmt.Println("\r\033[2")
-}
 
-func outSyncDiraction(ctx context.Context) {
-	panic("not implement")
+	return err
 }
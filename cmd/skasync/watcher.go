@@ -6,10 +6,12 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"skasync/cmd/skasync/api"
 	"skasync/pkg/cli"
 	"skasync/pkg/debug"
 	"skasync/pkg/docker"
+	"skasync/pkg/events"
 	"skasync/pkg/filemon"
 	"skasync/pkg/filesystem"
 	"skasync/pkg/git"
@@ -25,35 +27,47 @@ func RunWatcher(cfg *Config) {
 	mainCtx := context.Background()
 
 	watcherCh := make(chan []string, 100)
-	skaffoldLayerCh := make(chan []string, 100)
 	filesChangeListCh := make(chan filemon.ChangeList, 10)
+	endpointChangeMapCh := make(chan sync.EndpointChangeMap, 10)
 	errorsCh := make(chan error, 1)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
 
-	ccli := cli.NewCLI(cfg.Context, cfg.Namespace)
-	kubeCtl := cli.NewKubeCtl(ccli)
+	cliPool := cli.NewPool(cfg.Context, cfg.Namespace)
 	artifactService := docker.NewArtifactService(cfg.RootDir)
-	endpointsCtrl := k8s.NewEndpointsCtrl(cfg.RootDir, cfg.Endpoints, kubeCtl, artifactService)
+	endpointsCtrl := k8s.NewEndpointsCtrl(cfg.RootDir, cfg.Endpoints, cfg.Discovery, cliPool, artifactService)
 	refFilesMapService := filesystem.NewFilesMapService(cfg.RootDir)
 	watcher := filemon.NewWatcher(cfg.RootDir, cfg.Sync.Debounce)
-	endpointSyncker := sync.NewEndpointSyncker(cfg.RootDir, ccli, endpointsCtrl, refFilesMapService)
-	skaffoldStatusProbe := skaffold.NewStatusProbe(cfg.Skaffold.Addr, endpointsCtrl)
-	skaffoldStatusLayer := sync.NewSkaffoldStatusLayer(cfg.Skaffold.WatchingDeployStatus, skaffoldLayerCh, endpointsCtrl)
+	endpointSyncker := sync.NewEndpointSyncker(cfg.RootDir, endpointsCtrl, refFilesMapService, cfg.Sync.DebugContainer)
+	skaffoldClient, err := skaffold.NewAPIClient(cfg.Skaffold)
+	if err != nil {
+		log.Fatal(err)
+	}
+	skaffoldStatusProbe := skaffold.NewStatusProbe(skaffoldClient, artifactService)
+	journal := newJournal(cfg, watcher)
+	skaffoldStatusLayer := sync.NewSkaffoldStatusLayer(cfg.Skaffold.WatchingDeployStatus, endpointChangeMapCh, endpointsCtrl, skaffoldClient, journal)
 	gitCheckoutMon := git.NewCheckoutMon(cfg.RootDir)
 	gateway := filemon.NewGateway(cfg.Sync.Debounce)
 	debugChangeList := debug.NewChangeList()
+	debugEndpointEvents := debug.NewEndpointEvents()
+	stats := sync.NewStats()
+	eventsHub := events.NewHub()
+
+	// The API writes the discovery and the token files, they must not come back as changes
+	watcher.Exclude(api.RuntimeFiles(cfg.API, cfg.RootDir)...)
 
 	go func() {
 		errorsCh <- gitCheckoutMon.Listen(mainCtx)
 	}()
 
 	go func() {
-		fmt.Printf("API listening at: localhost:%d\n", cfg.API.Port)
-		errorsCh <- api.NewAPIListenerAndStart(cfg.API, func(e *echo.Echo) error {
-			api.NewSyncController(e.Group("/sync"), endpointSyncker, endpointsCtrl)
-			api.NewDebugController(e.Group("/debug"), debugChangeList)
+		errorsCh <- api.NewAPIListenerAndStart(cfg.API, cfg.RootDir, func(e *echo.Echo) error {
+			api.NewSyncController(e.Group("/sync"), endpointSyncker, endpointsCtrl, skaffoldStatusLayer)
+			api.NewEndpointsController(e.Group("/endpoints"), endpointsCtrl, skaffoldStatusLayer)
+			api.NewDebugController(e.Group("/debug"), debugChangeList, debugEndpointEvents)
+			api.NewStatusController(e.Group("/status"), endpointsCtrl, skaffoldStatusLayer, stats)
+			api.NewEventsController(e.Group("/events"), eventsHub)
 			return nil
 		})
 	}()
@@ -62,21 +76,64 @@ func RunWatcher(cfg *Config) {
 		log.Fatal(err)
 	}
 
-	if err := endpointsCtrl.Refresh(); err != nil {
-		log.Fatal(err)
+	// The endpoints are bound to the pods as the watch finds them
+	endpointsCtrl.Subscribe(skaffoldStatusLayer.EndpointHandler)
+	endpointsCtrl.Subscribe(debugEndpointEvents.Add)
+	endpointsCtrl.Subscribe(eventsHub.EndpointHandler)
+
+	go func() {
+		errorsCh <- endpointsCtrl.Listen(mainCtx)
+	}()
+
+	endpointSyncker.Subscribe(stats.AddSyncResult)
+	endpointSyncker.SubscribeStart(eventsHub.SyncStartHandler)
+	endpointSyncker.Subscribe(eventsHub.SyncResultHandler)
+
+	if journal != nil {
+		skaffoldStatusLayer.Restore(journal.Pending())
+
+		// The files of the failed sync stay in the journal and are synced again
+		endpointSyncker.Subscribe(func(result sync.SyncResult) {
+			if result.Err != nil {
+				skaffoldStatusLayer.Requeue(result.TagName)
+				return
+			}
+
+			journal.Remove(result.TagName, result.Files, result.StartedAt)
+		})
 	}
 
+	// The files switched by the reloaded ignore rules go through the gating like the other changes
+	artifactService.Subscribe(func(change docker.IgnoreChange) {
+		cl := sync.IgnoreChangeToChangeList(change, cfg.Sync.DeleteNewlyIgnored)
+		if cl.CountAll() == 0 {
+			return
+		}
+
+		fmt.Printf("Ignore rules of %s are reloaded, %d files are included, %d excluded\n", change.ArtifactId, len(change.Included), len(change.Excluded))
+
+		addToJournal(journal, cl.AllFilePathsList())
+		filesChangeListCh <- cl
+	})
+
+	go func() {
+		errorsCh <- artifactService.Listen(mainCtx)
+	}()
+
 	fsChangesCh := make(chan filemon.ChangeList, 10)
 	gateway.RegisterProvider(mainCtx, "fs", fsChangesCh)
 
 	gitCheckoutChangesCh := make(chan filemon.ChangeList, 10)
 	gitCheckoutMon.Subscribe(func(cl filemon.ChangeList) {
+		addToJournal(journal, cl.AllFilePathsList())
 		gitCheckoutChangesCh <- cl
 	})
 	gateway.RegisterProvider(mainCtx, "git.checkout", gitCheckoutChangesCh)
 
+	gateway.Subscribe(eventsHub.ChangeBatchHandler)
 	gateway.Subscribe(func(m map[string]filemon.ChangeList) {
 		a := filemon.GatewayResultToChangeList(m)
+		stats.AddChangeList()
 
 		if cfg.IsDebug {
 			id := debugChangeList.AddResult(m)
@@ -87,27 +144,36 @@ func RunWatcher(cfg *Config) {
 	})
 
 	skaffoldStatusProbe.Subscribe(skaffoldStatusLayer.StatusHandler)
+	skaffoldStatusProbe.Subscribe(eventsHub.SkaffoldStatusHandler)
 
 	go func() {
 		errorsCh <- watcher.Watch(mainCtx, watcherCh)
 	}()
 
 	go func() {
-		errorsCh <- skaffoldStatusLayer.Do(mainCtx, watcherCh)
+		errorsCh <- skaffoldStatusLayer.Do(mainCtx, filesChangeListCh)
 	}()
 
 	go func() {
 		errorsCh <- gateway.Start(mainCtx)
 	}()
 
+	// The endpoints, the artifacts and the debounce follow the config file
+	reloader := newConfigReloader(cfg, artifactService, endpointsCtrl, gateway, watcher)
+	go func() {
+		errorsCh <- reloader.Listen(mainCtx)
+	}()
+
 	go func() {
 		for {
-			fsChangesCh <- filemon.ChangeFilesToChangeListConverter(<-skaffoldLayerCh)
+			changeFiles := <-watcherCh
+			addToJournal(journal, changeFiles)
+			fsChangesCh <- filemon.ChangeFilesToChangeListConverter(changeFiles)
 		}
 	}()
 
 	go func() {
-		errorsCh <- endpointSyncker.Do(mainCtx, filesChangeListCh)
+		errorsCh <- endpointSyncker.Do(mainCtx, endpointChangeMapCh)
 	}()
 
 	go func() {
@@ -124,9 +190,56 @@ func RunWatcher(cfg *Config) {
 	select {
 	case err := <-errorsCh:
 		mainCtx.Done()
+		closeJournal(journal)
 		log.Fatal(err)
 	case <-sigChan:
 		mainCtx.Done()
 		println("Receive stop signal")
 	}
+
+	closeJournal(journal)
+
+	api.RemoveRuntimeFiles(cfg.API, cfg.RootDir)
+}
+
+// newJournal loads the changes not synced by the previous run, nil if the journal is disabled
+func newJournal(cfg *Config, watcher *filemon.Watcher) *sync.Journal {
+	if len(cfg.Sync.Journal) == 0 {
+		return nil
+	}
+
+	journalPath := cfg.Sync.Journal
+	if !filepath.IsAbs(journalPath) {
+		journalPath = filepath.Join(cfg.RootDir, journalPath)
+	}
+
+	// The journal writes must not come back as changes
+	watcher.Exclude(journalPath, journalPath+".tmp")
+
+	journal := sync.NewJournal(journalPath)
+	if err := journal.Load(); err != nil {
+		log.Fatalf("journal %s: %s", journalPath, err)
+	}
+
+	return journal
+}
+
+// addToJournal records the changes of the gateway providers before they are routed to the endpoints
+func addToJournal(journal *sync.Journal, files []string) {
+	if journal == nil {
+		return
+	}
+
+	journal.Add(sync.UnroutedTag, files)
+}
+
+// closeJournal writes the journal changes not written yet
+func closeJournal(journal *sync.Journal) {
+	if journal == nil {
+		return
+	}
+
+	if err := journal.Close(); err != nil {
+		fmt.Printf("Journal write failed: %s\n", err)
+	}
 }
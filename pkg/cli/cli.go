@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"os/exec"
+	"sync"
 )
 
 type CLI struct {
@@ -17,6 +18,19 @@ func NewCLI(kubeContext, namespace string) *CLI {
 	}
 }
 
+func (c *CLI) Context() string {
+	return c.kubeContext
+}
+
+func (c *CLI) Namespace() string {
+	return c.namespace
+}
+
+// String is the "context/namespace" pair of the CLI
+func (c *CLI) String() string {
+	return c.kubeContext + "/" + c.namespace
+}
+
 func (c *CLI) Command(ctx context.Context, command string, arg ...string) *exec.Cmd {
 	args := c.args(command, arg...)
 	return exec.CommandContext(ctx, "kubectl", args...)
@@ -35,3 +49,42 @@ func (c *CLI) args(command string, arg ...string) []string {
 	args = append(args, arg...)
 	return args
 }
+
+// Pool keeps a CLI per kube context and namespace pair, the empty values fall back to the defaults
+type Pool struct {
+	defaultContext   string
+	defaultNamespace string
+
+	mu   sync.Mutex
+	clis map[string]*CLI
+}
+
+func NewPool(defaultContext, defaultNamespace string) *Pool {
+	return &Pool{
+		defaultContext:   defaultContext,
+		defaultNamespace: defaultNamespace,
+		clis:             make(map[string]*CLI),
+	}
+}
+
+func (p *Pool) Get(kubeContext, namespace string) *CLI {
+	if len(kubeContext) == 0 {
+		kubeContext = p.defaultContext
+	}
+
+	if len(namespace) == 0 {
+		namespace = p.defaultNamespace
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := kubeContext + "/" + namespace
+	c, ok := p.clis[key]
+	if !ok {
+		c = NewCLI(kubeContext, namespace)
+		p.clis[key] = c
+	}
+
+	return c
+}
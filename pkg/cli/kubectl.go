@@ -3,7 +3,11 @@ package cli
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"path"
+	"sort"
 	"strings"
 )
 
@@ -15,17 +19,355 @@ func NewKubeCtl(cli *CLI) *KubeCtl {
 	return &KubeCtl{cli}
 }
 
-func (ctl *KubeCtl) GetPodName(selector string) (string, error) {
-	cmd := ctl.cli.Command(context.Background(), "get", "pods", "--field-selector=status.phase==Running", "--selector", selector, "-o", "jsonpath='{.items[0].metadata.name}'")
+const (
+	KindDeployment  = "deployment"
+	KindStatefulSet = "statefulset"
+	KindDaemonSet   = "daemonset"
+	KindService     = "service"
+)
+
+type labelSelector struct {
+	MatchLabels      map[string]string `json:"matchLabels"`
+	MatchExpressions []struct {
+		Key      string   `json:"key"`
+		Operator string   `json:"operator"`
+		Values   []string `json:"values"`
+	} `json:"matchExpressions"`
+}
+
+// String converts the selector to the kubectl --selector form
+func (ls labelSelector) String() string {
+	parts := make([]string, 0, len(ls.MatchLabels)+len(ls.MatchExpressions))
+
+	for key, value := range ls.MatchLabels {
+		parts = append(parts, key+"="+value)
+	}
+	sort.Strings(parts)
+
+	for _, e := range ls.MatchExpressions {
+		switch e.Operator {
+		case "In":
+			parts = append(parts, fmt.Sprintf("%s in (%s)", e.Key, strings.Join(e.Values, ",")))
+		case "NotIn":
+			parts = append(parts, fmt.Sprintf("%s notin (%s)", e.Key, strings.Join(e.Values, ",")))
+		case "Exists":
+			parts = append(parts, e.Key)
+		case "DoesNotExist":
+			parts = append(parts, "!"+e.Key)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// GetWorkloadSelector returns the pod selector of the deployment, statefulset, daemonset or service
+func (ctl *KubeCtl) GetWorkloadSelector(kind, name string) (string, error) {
+	cmd := ctl.cli.Command(context.Background(), "get", kind, name, "-o", "json")
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s \"%s\": %s", kind, name, strings.TrimSpace(stderr.String()))
+	}
+
+	selector := ""
+
+	if kind == KindService {
+		svc := struct {
+			Spec struct {
+				Selector map[string]string `json:"selector"`
+			} `json:"spec"`
+		}{}
+		if err := json.Unmarshal(stdout.Bytes(), &svc); err != nil {
+			return "", err
+		}
+
+		selector = labelSelector{MatchLabels: svc.Spec.Selector}.String()
+	} else {
+		workload := struct {
+			Spec struct {
+				Selector labelSelector `json:"selector"`
+			} `json:"spec"`
+		}{}
+		if err := json.Unmarshal(stdout.Bytes(), &workload); err != nil {
+			return "", err
+		}
+
+		selector = workload.Spec.Selector.String()
+	}
+
+	if len(selector) == 0 {
+		return "", fmt.Errorf("%s \"%s\" has no pod selector", kind, name)
+	}
+
+	return selector, nil
+}
+
+// CurrentContext returns the kube context kubectl uses without --context
+func (ctl *KubeCtl) CurrentContext() (string, error) {
+	return ctl.output("config", "current-context")
+}
+
+// CurrentNamespace returns the namespace of the context, "default" if the context has none
+func (ctl *KubeCtl) CurrentNamespace() (string, error) {
+	namespace, err := ctl.output("config", "view", "--minify", "-o", "jsonpath={..namespace}")
+	if err != nil {
+		return "", err
+	}
+
+	if len(namespace) == 0 {
+		return "default", nil
+	}
+
+	return namespace, nil
+}
+
+func (ctl *KubeCtl) output(command string, arg ...string) (string, error) {
+	cmd := ctl.cli.Command(context.Background(), command, arg...)
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() == 0 {
+			return "", fmt.Errorf("%s: %w", command, err)
+		}
+
+		return "", fmt.Errorf("%s: %s", command, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+const (
+	PodEventAdded    = "ADDED"
+	PodEventModified = "MODIFIED"
+	PodEventDeleted  = "DELETED"
+)
+
+// Pod holds the pod fields skasync needs from the kubectl output
+type Pod struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		GenerateName      string            `json:"generateName"`
+		Labels            map[string]string `json:"labels"`
+		Annotations       map[string]string `json:"annotations"`
+		CreationTimestamp string            `json:"creationTimestamp"`
+		DeletionTimestamp *string           `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		Containers []struct {
+			Name         string        `json:"name"`
+			Image        string        `json:"image"`
+			VolumeMounts []VolumeMount `json:"volumeMounts"`
+		} `json:"containers"`
+		ShareProcessNamespace bool `json:"shareProcessNamespace"`
+	} `json:"spec"`
+	Status struct {
+		Phase             string            `json:"phase"`
+		ContainerStatuses []ContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type VolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath"`
+}
+
+type ContainerStatus struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	State struct {
+		Waiting *struct {
+			Reason string `json:"reason"`
+		} `json:"waiting"`
+		Terminated *struct {
+			Reason string `json:"reason"`
+		} `json:"terminated"`
+	} `json:"state"`
+	// ContainerID is "<runtime>://<id>"
+	ContainerID string `json:"containerID"`
+}
+
+// IsRunning reports whether the pod is running and not terminating
+func (p Pod) IsRunning() bool {
+	return p.Status.Phase == "Running" && p.Metadata.DeletionTimestamp == nil
+}
+
+// IsContainerReady reports whether the files can be synced to the container of the pod
+func (p Pod) IsContainerReady(container string) bool {
+	return len(p.ContainerUnavailableReason(container)) == 0
+}
+
+// ContainerUnavailableReason explains why the container can't be synced, empty if it can
+func (p Pod) ContainerUnavailableReason(container string) string {
+	if p.Metadata.DeletionTimestamp != nil {
+		return fmt.Sprintf("pod %s is terminating", p.Metadata.Name)
+	}
+
+	if p.Status.Phase != "Running" {
+		return fmt.Sprintf("pod %s is %s", p.Metadata.Name, p.Status.Phase)
+	}
+
+	for _, status := range p.Status.ContainerStatuses {
+		if status.Name != container {
+			continue
+		}
+
+		switch {
+		case status.State.Waiting != nil:
+			return fmt.Sprintf("container %s of pod %s is waiting: %s", container, p.Metadata.Name, status.State.Waiting.Reason)
+		case status.State.Terminated != nil:
+			return fmt.Sprintf("container %s of pod %s is terminated: %s", container, p.Metadata.Name, status.State.Terminated.Reason)
+		case !status.Ready:
+			return fmt.Sprintf("container %s of pod %s is not ready", container, p.Metadata.Name)
+		}
+
+		return ""
+	}
+
+	return fmt.Sprintf("pod %s has no container %s", p.Metadata.Name, container)
+}
+
+// VolumePath returns the location of the container path in the pod volumes as "volume:path",
+// the containers sharing the location see the same files. The path that is not on a volume is
+// local to the container, ok is false then
+func (p Pod) VolumePath(container, containerPath string) (location string, ok bool) {
+	containerPath = path.Clean(containerPath)
+
+	for _, c := range p.Spec.Containers {
+		if c.Name != container {
+			continue
+		}
+
+		// The deepest mount covering the path wins
+		var mount *VolumeMount
+		for i, m := range c.VolumeMounts {
+			mountPath := path.Clean(m.MountPath)
+			if containerPath != mountPath && !strings.HasPrefix(containerPath, strings.TrimSuffix(mountPath, "/")+"/") {
+				continue
+			}
+
+			if mount == nil || len(mountPath) > len(path.Clean(mount.MountPath)) {
+				mount = &c.VolumeMounts[i]
+			}
+		}
+
+		if mount == nil {
+			return "", false
+		}
+
+		relPath := strings.TrimPrefix(containerPath, path.Clean(mount.MountPath))
+
+		return mount.Name + ":" + path.Join("/", mount.SubPath, relPath), true
+	}
+
+	return "", false
+}
+
+type PodEvent struct {
+	Type   string `json:"type"`
+	Object Pod    `json:"object"`
+}
+
+// GetPods lists the pods matching the selector, all pods of the namespace if the selector is empty
+func (ctl *KubeCtl) GetPods(selector string) ([]Pod, error) {
+	args := []string{"pods", "-o", "json"}
+	if len(selector) > 0 {
+		args = append(args, "--selector", selector)
+	}
+
+	cmd := ctl.cli.Command(context.Background(), "get", args...)
 	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
 	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
-	cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("get pods: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	list := struct {
+		Items []Pod `json:"items"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &list); err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+// WorkloadName is the name of the pod without the generated suffixes, it stays the same
+// when the pod is recreated by its workload
+func (p Pod) WorkloadName() string {
+	if len(p.Metadata.GenerateName) == 0 {
+		return p.Metadata.Name
+	}
+
+	name := strings.TrimSuffix(p.Metadata.GenerateName, "-")
+	if hash, ok := p.Metadata.Labels["pod-template-hash"]; ok {
+		name = strings.TrimSuffix(name, "-"+hash)
+	}
+
+	return name
+}
+
+// WatchPods calls cb for every change of the pods matching the selector, all pods of the
+// namespace if the selector is empty. The existing pods come first as added. Blocks until the watch ends
+func (ctl *KubeCtl) WatchPods(ctx context.Context, selector string, cb func(PodEvent)) error {
+	args := []string{"pods", "--watch", "--output-watch-events", "-o", "json"}
+	if len(selector) > 0 {
+		args = append(args, "--selector", selector)
+	}
 
-	name := strings.Trim(strings.Trim(stdout.String(), ""), "'")
-	if len(name) == 0 {
-		return "", fmt.Errorf("not found pod by selector \"%s\"", selector)
+	// The broken output stops kubectl, it would block on the full pipe otherwise
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := ctl.cli.Command(watchCtx, "get", args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// kubectl writes the events as concatenated JSON objects
+	decoder := json.NewDecoder(stdout)
+	var decodeErr error
+	for {
+		event := PodEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if err != io.EOF {
+				decodeErr = err
+				cancel()
+			}
+			break
+		}
+
+		cb(event)
+	}
+
+	err = cmd.Wait()
+	if decodeErr != nil && ctx.Err() == nil {
+		return fmt.Errorf("pods watch \"%s\": output is not read: %w", selector, decodeErr)
+	}
+	if stderr.Len() > 0 {
+		return fmt.Errorf("pods watch \"%s\": %s", selector, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("pods watch \"%s\": %w", selector, err)
 	}
 
-	return name, nil
+	return io.EOF
 }
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaKey is the root key pointing editors to the JSON Schema, it is allowed in every config
+const SchemaKey = "$schema"
+
+// Issue is the config problem at the file position, Line is 0 if the position is unknown
+type Issue struct {
+	FilePath string
+	Line,
+	Column int
+	Message string
+}
+
+func (i Issue) Error() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.FilePath, i.Message)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", i.FilePath, i.Line, i.Column, i.Message)
+}
+
+// SortIssues orders the issues by the file and the position in it
+func SortIssues(issues []Issue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].FilePath != issues[j].FilePath {
+			return issues[i].FilePath < issues[j].FilePath
+		}
+
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+
+		return issues[i].Column < issues[j].Column
+	})
+}
+
+// CheckKeys reports the unknown keys and the values of a wrong type against the type of v
+func (d *Document) CheckKeys(v interface{}) []Issue {
+	issues := make([]Issue, 0)
+
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	d.checkNode(d.Root, t, "", true, &issues)
+
+	return issues
+}
+
+func (d *Document) checkNode(node *yaml.Node, t reflect.Type, keyPath string, isRoot bool, issues *[]Issue) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if !d.expectKind(node, yaml.MappingNode, "an object", keyPath, issues) {
+			return
+		}
+
+		fields := structFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			field, ok := findField(fields, key.Value)
+			if !ok {
+				if isRoot && key.Value == SchemaKey {
+					continue
+				}
+
+				*issues = append(*issues, d.Issue(key, fmt.Sprintf("unknown key \"%s\"", joinKeyPath(keyPath, key.Value))))
+				continue
+			}
+
+			d.checkNode(value, field.Type, joinKeyPath(keyPath, field.Name), false, issues)
+		}
+	case reflect.Map:
+		if !d.expectKind(node, yaml.MappingNode, "an object", keyPath, issues) {
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			d.checkNode(node.Content[i+1], t.Elem(), joinKeyPath(keyPath, node.Content[i].Value), false, issues)
+		}
+	case reflect.Slice, reflect.Array:
+		if !d.expectKind(node, yaml.SequenceNode, "an array", keyPath, issues) {
+			return
+		}
+
+		for i, item := range node.Content {
+			d.checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", keyPath, i), false, issues)
+		}
+	case reflect.String:
+		d.expectTag(node, "!!str", "a string", keyPath, issues)
+	case reflect.Bool:
+		d.expectTag(node, "!!bool", "a boolean", keyPath, issues)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		d.expectTag(node, "!!int", "an integer", keyPath, issues)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if d.expectTag(node, "!!int", "an integer", keyPath, issues) && strings.HasPrefix(node.Value, "-") {
+			*issues = append(*issues, d.Issue(node, fmt.Sprintf("%s must not be negative", keyPath)))
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Tag != "!!int" {
+			d.expectTag(node, "!!float", "a number", keyPath, issues)
+		}
+	}
+}
+
+func (d *Document) expectKind(node *yaml.Node, kind yaml.Kind, name, keyPath string, issues *[]Issue) bool {
+	if node.Kind == kind {
+		return true
+	}
+
+	*issues = append(*issues, d.Issue(node, fmt.Sprintf("%s must be %s", keyPathOrRoot(keyPath), name)))
+
+	return false
+}
+
+func (d *Document) expectTag(node *yaml.Node, tag, name, keyPath string, issues *[]Issue) bool {
+	if node.Kind == yaml.ScalarNode && node.Tag == tag {
+		return true
+	}
+
+	*issues = append(*issues, d.Issue(node, fmt.Sprintf("%s must be %s", keyPathOrRoot(keyPath), name)))
+
+	return false
+}
+
+// structFields returns the fields encoding/json decodes, the embedded structs are not used by the config
+func structFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if len(name) > 0 {
+			field.Name = name
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// findField matches the key as encoding/json does, the exact name wins
+func findField(fields []reflect.StructField, key string) (reflect.StructField, bool) {
+	for _, field := range fields {
+		if field.Name == key {
+			return field, true
+		}
+	}
+
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func joinKeyPath(keyPath, key string) string {
+	if len(keyPath) == 0 {
+		return key
+	}
+
+	return keyPath + "." + key
+}
+
+func keyPathOrRoot(keyPath string) string {
+	if len(keyPath) == 0 {
+		return "config"
+	}
+
+	return keyPath
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckKeys(t *testing.T) {
+	doc := mustParse(t, "skasync.config.json", `{
+    "$schema": "./skasync.schema.json",
+    "rootdir": "/src",
+    "Debounce": "100",
+    "Watch": "yes",
+    "Unknown": 1,
+    "Endpoints": {
+        "app": {"Artifact": "app", "Selector": ["app=app"], "Container": "php"}
+    },
+    "Ignore": "vendor"
+}`)
+
+	issues := doc.CheckKeys(&testConfig{})
+	SortIssues(issues)
+
+	want := []string{
+		"skasync.config.json:4:17: Debounce must be an integer",
+		"skasync.config.json:5:14: Watch must be a boolean",
+		"skasync.config.json:6:5: unknown key \"Unknown\"",
+		"skasync.config.json:8:48: Endpoints.app.Selector must be a string",
+		"skasync.config.json:8:61: unknown key \"Endpoints.app.Container\"",
+		"skasync.config.json:10:15: Ignore must be an array",
+	}
+
+	got := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		got = append(got, issue.Error())
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("CheckKeys() issues:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseRejectsNotObject(t *testing.T) {
+	if _, err := Parse("skasync.config.json", []byte(`["a"]`)); err == nil || !strings.Contains(err.Error(), "must be an object") {
+		t.Errorf("Parse() error = %v, want the object error", err)
+	}
+
+	if _, err := Parse("skasync.config.toml", []byte(`a = 1`)); err == nil {
+		t.Error("Parse() of the unsupported extension error = nil")
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Extensions are the supported config file extensions in the lookup order of the default config file
+var Extensions = []string{".json", ".jsonc", ".yaml", ".yml"}
+
+// Document is the parsed config file. JSON with comments is parsed by the YAML parser as well,
+// so the values of both formats keep their file positions
+type Document struct {
+	FilePath string
+	Root     *yaml.Node
+
+	// files are the files of the nodes merged from other files, see Merge
+	files map[*yaml.Node]string
+}
+
+// Load reads the config file, the format is selected by the extension
+func Load(filePath string) (*Document, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(filePath, data)
+}
+
+// Parse parses the config data of the file
+func Parse(filePath string, data []byte) (*Document, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json", ".jsonc":
+		data = stripJSONComments(data)
+	case ".yaml", ".yml":
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file extension, one of %s is expected", filePath, strings.Join(Extensions, ", "))
+	}
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s: config is empty", filePath)
+	}
+
+	doc := &Document{
+		FilePath: filePath,
+		Root:     root.Content[0],
+	}
+
+	if doc.Root.Kind != yaml.MappingNode {
+		return nil, doc.Errorf(doc.Root, "config must be an object")
+	}
+
+	return doc, nil
+}
+
+// Decode sets the values of the document to v. The keys are matched as encoding/json does,
+// so they are case insensitive in both formats
+func (d *Document) Decode(v interface{}) error {
+	var value interface{}
+	if err := d.Root.Decode(&value); err != nil {
+		return fmt.Errorf("%s: %w", d.FilePath, err)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.FilePath, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", d.FilePath, err)
+	}
+
+	return nil
+}
+
+// Lookup returns the value node by the keys path, nil if it is not set. The map keys are
+// matched exactly, the struct fields case insensitively
+func (d *Document) Lookup(keys ...string) *yaml.Node {
+	node := d.Root
+	for _, key := range keys {
+		node = mappingValue(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+// Errorf returns the error at the position of the node
+func (d *Document) Errorf(node *yaml.Node, format string, a ...interface{}) error {
+	return d.Issue(node, fmt.Sprintf(format, a...))
+}
+
+// Issue returns the issue at the position of the node, the issue of the nil node has the file position only
+func (d *Document) Issue(node *yaml.Node, message string) Issue {
+	issue := Issue{FilePath: d.FilePath, Message: message}
+	if filePath, ok := d.files[node]; ok {
+		issue.FilePath = filePath
+	}
+
+	if node != nil {
+		issue.Line = node.Line
+		issue.Column = node.Column
+	}
+
+	return issue
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	index := mappingKeyIndex(node, key)
+	if index < 0 {
+		return nil
+	}
+
+	return node.Content[index+1]
+}
+
+// stripJSONComments replaces the // and /* */ comments and the tabs outside of the strings
+// with spaces, the line and column positions are kept
+func stripJSONComments(data []byte) []byte {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+
+	inString, isEscaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out.WriteByte(c)
+
+			switch {
+			case isEscaped:
+				isEscaped = false
+			case c == '\\':
+				isEscaped = true
+			case c == '"':
+				inString = false
+			}
+
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '\t':
+			out.WriteByte(' ')
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for ; i < len(data) && data[i] != '\n'; i++ {
+				out.WriteByte(' ')
+			}
+
+			if i < len(data) {
+				out.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(data) - i - 2
+			} else {
+				end += 2
+			}
+
+			for _, b := range data[i : i+2+end] {
+				if b == '\n' {
+					out.WriteByte('\n')
+				} else {
+					out.WriteByte(' ')
+				}
+			}
+
+			i += 1 + end
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.Bytes()
+}
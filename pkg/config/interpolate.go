@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPattern matches ${NAME} and ${NAME:-default}, $${ is the escaped ${
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Interpolate replaces ${NAME} and ${NAME:-default} in the string values of the document with
+// the values of lookupEnv. The variable that is not set and has no default is an issue
+func (d *Document) Interpolate(lookupEnv func(string) (string, bool)) []Issue {
+	issues := make([]Issue, 0)
+	d.interpolateNode(d.Root, lookupEnv, &issues)
+
+	return issues
+}
+
+func (d *Document) interpolateNode(node *yaml.Node, lookupEnv func(string) (string, bool), issues *[]Issue) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		// The keys are not interpolated
+		for i := 1; i < len(node.Content); i += 2 {
+			d.interpolateNode(node.Content[i], lookupEnv, issues)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			d.interpolateNode(item, lookupEnv, issues)
+		}
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" || !strings.Contains(node.Value, "${") {
+			return
+		}
+
+		node.Value = envPattern.ReplaceAllStringFunc(node.Value, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+
+			groups := envPattern.FindStringSubmatch(match)
+			value, ok := lookupEnv(groups[1])
+
+			// The default is used for the empty variable as well, as sh does
+			hasDefault := len(groups[2]) > 0
+			if hasDefault && len(value) == 0 {
+				return groups[3]
+			}
+
+			if ok {
+				return value
+			}
+
+			*issues = append(*issues, d.Issue(node, fmt.Sprintf("environment variable %s is not set", groups[1])))
+
+			return ""
+		})
+	}
+}
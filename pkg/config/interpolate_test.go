@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	doc := mustParse(t, "skasync.config.yaml", `
+rootDir: ${HOME_DIR}/src
+endpoints:
+  app:
+    artifact: ${ARTIFACT:-app}
+    selector: app=${EMPTY:-default}
+ignore:
+  - $${NOT_A_VAR}
+  - ${MISSING}/logs
+${KEY}: 1
+debounce: 100
+`)
+
+	env := map[string]string{"HOME_DIR": "/home/dev", "EMPTY": "", "KEY": "key"}
+	issues := doc.Interpolate(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, "MISSING") || issues[0].Line != 9 {
+		t.Errorf("issues = %v, want the unset MISSING at line 9", issues)
+	}
+
+	cfg := testConfig{}
+	if err := doc.Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RootDir != "/home/dev/src" {
+		t.Errorf("RootDir = %q, want /home/dev/src", cfg.RootDir)
+	}
+
+	// The default is used for the empty variable as well
+	if ep := cfg.Endpoints["app"]; ep.Artifact != "app" || ep.Selector != "app=default" {
+		t.Errorf("endpoint app = %+v, want the defaults", ep)
+	}
+
+	if want := []string{"${NOT_A_VAR}", "/logs"}; strings.Join(cfg.Ignore, ",") != strings.Join(want, ",") {
+		t.Errorf("Ignore = %v, want %v", cfg.Ignore, want)
+	}
+
+	// The keys are not interpolated
+	if doc.Lookup("${KEY}") == nil {
+		t.Error("key ${KEY} is interpolated")
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merge applies the mapping node of the file over the document: the objects are merged key by key,
+// the other values are replaced. The merged values keep the positions in their file
+func (d *Document) Merge(filePath string, node *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	if d.files == nil {
+		d.files = make(map[*yaml.Node]string)
+	}
+
+	d.Root = d.mergeNode(d.Root, node, filePath)
+}
+
+// Delete removes the root key, it is matched as Lookup does
+func (d *Document) Delete(key string) {
+	index := mappingKeyIndex(d.Root, key)
+	if index < 0 {
+		return
+	}
+
+	d.Root.Content = append(d.Root.Content[:index], d.Root.Content[index+2:]...)
+}
+
+func (d *Document) mergeNode(dst, src *yaml.Node, filePath string) *yaml.Node {
+	if dst == nil || dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		d.setFile(src, filePath)
+		return src
+	}
+
+	merged := *dst
+	merged.Content = append([]*yaml.Node{}, dst.Content...)
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		index := mappingKeyIndex(&merged, key.Value)
+		if index < 0 {
+			d.setFile(key, filePath)
+			d.setFile(value, filePath)
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+
+		merged.Content[index+1] = d.mergeNode(merged.Content[index+1], value, filePath)
+	}
+
+	return &merged
+}
+
+// setFile records the file of the nodes that came from another file than the document
+func (d *Document) setFile(node *yaml.Node, filePath string) {
+	if filePath == d.FilePath {
+		return
+	}
+
+	d.files[node] = filePath
+	for _, child := range node.Content {
+		d.setFile(child, filePath)
+	}
+}
+
+// mappingKeyIndex returns the index of the key node, -1 if there is none. The exact key wins
+func mappingKeyIndex(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+
+	folded := -1
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+
+		if folded < 0 && strings.EqualFold(node.Content[i].Value, key) {
+			folded = i
+		}
+	}
+
+	return folded
+}
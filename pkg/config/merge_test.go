@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testConfig struct {
+	RootDir   string
+	Debounce  int
+	Watch     bool
+	Endpoints map[string]testEndpoint
+	Ignore    []string
+}
+
+type testEndpoint struct {
+	Artifact string
+	Selector string
+}
+
+func mustParse(t *testing.T, filePath, data string) *Document {
+	t.Helper()
+
+	doc, err := Parse(filePath, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func TestMerge(t *testing.T) {
+	doc := mustParse(t, "skasync.config.json", `{
+    // The shared config
+    "RootDir": "/src",
+    "Endpoints": {
+        "app": {"Artifact": "app", "Selector": "app=app"},
+        "worker": {"Artifact": "app", "Selector": "app=worker"}
+    },
+    "Ignore": ["vendor", "logs"]
+}`)
+	local := mustParse(t, "skasync.config.local.yaml", `
+endpoints:
+  app:
+    selector: app=local
+  debug:
+    artifact: debug
+    selector: app=debug
+ignore:
+  - tmp
+debounce: 100
+`)
+
+	doc.Merge(local.FilePath, local.Root)
+
+	cfg := testConfig{}
+	if err := doc.Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := testConfig{
+		RootDir:  "/src",
+		Debounce: 100,
+		Endpoints: map[string]testEndpoint{
+			// The objects are merged key by key, the key of another case is the same key
+			"app":    {Artifact: "app", Selector: "app=local"},
+			"worker": {Artifact: "app", Selector: "app=worker"},
+			"debug":  {Artifact: "debug", Selector: "app=debug"},
+		},
+		// The arrays are replaced
+		Ignore: []string{"tmp"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("merged config = %+v, want %+v", cfg, want)
+	}
+
+	// The merged values keep the positions in their file
+	issue := doc.Issue(doc.Lookup("Endpoints", "debug", "artifact"), "issue")
+	if issue.FilePath != local.FilePath || issue.Line != 6 {
+		t.Errorf("issue of the merged value = %+v, want %s:6", issue, local.FilePath)
+	}
+
+	issue = doc.Issue(doc.Lookup("RootDir"), "issue")
+	if issue.FilePath != doc.FilePath || issue.Line != 3 {
+		t.Errorf("issue of the kept value = %+v, want %s:3", issue, doc.FilePath)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	doc := mustParse(t, "skasync.config.yaml", "rootDir: /src\ndebounce: 100\n")
+	doc.Delete("RootDir")
+	doc.Delete("Missing")
+
+	if doc.Lookup("rootDir") != nil || doc.Lookup("debounce") == nil {
+		t.Errorf("Delete(RootDir) left the keys %v", doc.Root.Content)
+	}
+}
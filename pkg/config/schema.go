@@ -0,0 +1,73 @@
+package config
+
+import (
+	"reflect"
+)
+
+// SchemaDraft is the JSON Schema version of the generated schema
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Schema returns the JSON Schema of the config type v, the objects don't allow unknown keys
+func Schema(title string, v interface{}) map[string]interface{} {
+	t := reflect.TypeOf(v)
+	schema := typeSchema(t, t)
+	schema["$schema"] = SchemaDraft
+	schema["title"] = title
+
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		properties[SchemaKey] = map[string]interface{}{"type": "string"}
+	}
+
+	return schema
+}
+
+// typeSchema returns the schema of the type, the nested root type (see profiles) refers to the root schema
+func typeSchema(t, root reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for _, field := range structFields(t) {
+			properties[field.Name] = elemSchema(field.Type, root)
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": elemSchema(t.Elem(), root),
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": elemSchema(t.Elem(), root),
+		}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func elemSchema(t, root reflect.Type) map[string]interface{} {
+	if t == root {
+		return map[string]interface{}{"$ref": "#"}
+	}
+
+	return typeSchema(t, root)
+}
@@ -0,0 +1,47 @@
+package debug
+
+import (
+	"skasync/pkg/k8s"
+	"sync"
+	"time"
+)
+
+const maxEndpointEvents = 100
+
+type EndpointEvent struct {
+	k8s.EndpointEvent
+	Time time.Time
+}
+
+// EndpointEvents keeps the last endpoint events
+type EndpointEvents struct {
+	mu   sync.Mutex
+	list []EndpointEvent
+}
+
+func NewEndpointEvents() *EndpointEvents {
+	return &EndpointEvents{
+		list: make([]EndpointEvent, 0, maxEndpointEvents),
+	}
+}
+
+func (ee *EndpointEvents) Add(e k8s.EndpointEvent) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	if len(ee.list) == maxEndpointEvents {
+		ee.list = ee.list[1:]
+	}
+
+	ee.list = append(ee.list, EndpointEvent{e, time.Now()})
+}
+
+func (ee *EndpointEvents) List() []EndpointEvent {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	list := make([]EndpointEvent, len(ee.list))
+	copy(list, ee.list)
+
+	return list
+}
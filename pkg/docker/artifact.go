@@ -3,6 +3,11 @@ package docker
 import (
 	"errors"
 	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"sync"
 )
 
@@ -14,27 +19,160 @@ var (
 type ArtifactConfig struct {
 	Image,
 	RootDir,
-	DockerfileDir string
+	// Docker build context, the workspace if empty
+	Context,
+	DockerfileDir,
+	// Dockerfile name in DockerfileDir, "Dockerfile" if empty
+	Dockerfile string
+	// Values of dockerfile ARG, used for sync mappings inferring
+	BuildArgs map[string]string
+	// Manual sync rules, used when RootDir is not set
+	Sync []SyncRule
+	// Globs (relative to the build context) of the files which can't be synced,
+	// their change requires the image rebuild
+	RebuildTriggers []string
+}
+
+func (cfg ArtifactConfig) DockerfilePath() string {
+	if len(cfg.Dockerfile) == 0 {
+		return filepath.Join(cfg.DockerfileDir, DockerfileName)
+	}
+
+	return filepath.Join(cfg.DockerfileDir, cfg.Dockerfile)
+}
+
+func (cfg ArtifactConfig) contextDir(workspace string) string {
+	if len(cfg.Context) == 0 {
+		return workspace
+	}
+
+	return cfg.Context
 }
 
 type Artifact struct {
 	Id,
 	Image,
-	RootDir string
-	DockerIgnorePredicate Predicate
+	RootDir,
+	ContextDir string
+
+	syncRules       []syncRuleMatcher
+	rebuildTriggers []*regexp.Regexp
+
+	mu                    sync.RWMutex
+	dockerIgnorePredicate Predicate
+	// dockerIgnorePatterns are the patterns of the predicate, the reload compares them
+	dockerIgnorePatterns []string
+	syncMappings         []SyncMapping
+}
+
+func (a *Artifact) DockerIgnorePredicate() Predicate {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.dockerIgnorePredicate
+}
+
+func (a *Artifact) dockerIgnore() (Predicate, []string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.dockerIgnorePredicate, a.dockerIgnorePatterns
+}
+
+func (a *Artifact) setDockerIgnore(predicate Predicate, patterns []string) {
+	a.mu.Lock()
+	a.dockerIgnorePredicate = predicate
+	a.dockerIgnorePatterns = patterns
+	a.mu.Unlock()
+}
+
+// SyncMappings returns the mappings inferred from dockerfile, empty if RootDir is set
+func (a *Artifact) SyncMappings() []SyncMapping {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.syncMappings
+}
+
+func (a *Artifact) setSyncMappings(mappings []SyncMapping) {
+	a.mu.Lock()
+	a.syncMappings = mappings
+	a.mu.Unlock()
+}
+
+// IsRebuildTrigger reports whether the change of the local file requires the image rebuild
+func (a *Artifact) IsRebuildTrigger(localPath string) bool {
+	if len(a.rebuildTriggers) == 0 {
+		return false
+	}
+
+	relPath, err := filepath.Rel(a.ContextDir, localPath)
+	if err != nil || isOutsideRel(relPath) {
+		return false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+
+	for _, re := range a.rebuildTriggers {
+		if re.MatchString(relPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SyncRules returns the manual sync rules with the container paths resolved
+func (a *Artifact) SyncRules() []SyncRule {
+	rules := make([]SyncRule, 0, len(a.syncRules))
+	for _, m := range a.syncRules {
+		rules = append(rules, m.rule)
+	}
+
+	return rules
+}
+
+// RemotePath returns the container path of the local file. RootDir has priority over
+// manual sync rules, the mappings inferred from dockerfile are used last
+func (a *Artifact) RemotePath(localPath string) (string, bool) {
+	if len(a.RootDir) > 0 {
+		relPath, err := filepath.Rel(a.ContextDir, localPath)
+		if err != nil || isOutsideRel(relPath) {
+			return "", false
+		}
+
+		return path.Join(a.RootDir, filepath.ToSlash(relPath)), true
+	}
+
+	if len(a.syncRules) > 0 {
+		return resolveSyncRules(a.syncRules, a.ContextDir, localPath)
+	}
+
+	return ResolveRemotePath(a.SyncMappings(), a.ContextDir, localPath)
+}
+
+// IgnoreChange describes the files whose ignore state was switched by the reloaded ignore rules
+type IgnoreChange struct {
+	ArtifactId string
+	Included,
+	Excluded []string
 }
 
 type ArtifactService struct {
 	rootDir string
 
-	mu   sync.Mutex
-	list map[string]*Artifact
+	mu          sync.Mutex
+	list        map[string]*Artifact
+	cfgs        map[string]ArtifactConfig
+	subscribers []func(IgnoreChange)
+	// sourcesChangedCh wakes Listen up to watch the ignore sources of the updated artifacts
+	sourcesChangedCh chan struct{}
 }
 
 func NewArtifactService(rootDir string) *ArtifactService {
 	return &ArtifactService{
-		rootDir: rootDir,
-		list:    make(map[string]*Artifact),
+		rootDir:          rootDir,
+		list:             make(map[string]*Artifact),
+		cfgs:             make(map[string]ArtifactConfig),
+		subscribers:      make([]func(IgnoreChange), 0),
+		sourcesChangedCh: make(chan struct{}, 1),
 	}
 }
 
@@ -53,35 +191,275 @@ func (as *ArtifactService) Register(id string, cfg ArtifactConfig) error {
 		return ErrArtifactIsExisted
 	}
 
-	ignoreList, err := GetIgnoreList(as.rootDir, cfg.DockerfileDir)
+	artifact, err := as.newArtifact(id, cfg)
 	if err != nil {
 		return err
 	}
 
-	dockerIgnorePredicate, err := NewDockerIgnorePredicate(as.rootDir, ignoreList)
-	if err != nil {
-		return err
+	as.mu.Lock()
+	as.list[id] = artifact
+	as.cfgs[id] = cfg
+	as.mu.Unlock()
+
+	return nil
+}
+
+// Update replaces the artifacts with the new configs and returns the ids of the added, changed and
+// removed artifacts. Nothing is changed if one of the configs is invalid. The changed artifacts are
+// new instances, the holders of the old ones must look them up again
+func (as *ArtifactService) Update(artifacts map[string]ArtifactConfig) ([]string, error) {
+	// The map itself is written under the lock below, the copy is iterated
+	as.mu.Lock()
+	cfgs := make(map[string]ArtifactConfig, len(as.cfgs))
+	for id, cfg := range as.cfgs {
+		cfgs[id] = cfg
+	}
+	as.mu.Unlock()
+
+	built := make(map[string]*Artifact)
+	for id, cfg := range artifacts {
+		if prevCfg, ok := cfgs[id]; ok && reflect.DeepEqual(prevCfg, cfg) {
+			continue
+		}
+
+		artifact, err := as.newArtifact(id, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		built[id] = artifact
 	}
 
+	changed := make([]string, 0, len(built))
+
 	as.mu.Lock()
-	as.list[id] = &Artifact{
+	for id, artifact := range built {
+		as.list[id] = artifact
+		as.cfgs[id] = artifacts[id]
+		changed = append(changed, id)
+	}
+
+	for id := range as.list {
+		if _, ok := artifacts[id]; !ok {
+			delete(as.list, id)
+			delete(as.cfgs, id)
+			changed = append(changed, id)
+		}
+	}
+	as.mu.Unlock()
+
+	sort.Strings(changed)
+
+	if len(changed) > 0 {
+		select {
+		case as.sourcesChangedCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return changed, nil
+}
+
+func (as *ArtifactService) newArtifact(id string, cfg ArtifactConfig) (*Artifact, error) {
+	dockerIgnorePredicate, dockerIgnorePatterns, err := as.buildDockerIgnorePredicate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	syncMappings, err := as.inferSyncMappings(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("artifact \"%s\": %w", id, err)
+	}
+
+	syncRules, err := as.buildSyncRules(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("artifact \"%s\": %w", id, err)
+	}
+
+	rebuildTriggers := make([]*regexp.Regexp, 0, len(cfg.RebuildTriggers))
+	for _, glob := range cfg.RebuildTriggers {
+		re, err := globToRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("artifact \"%s\": rebuild trigger \"%s\": %w", id, glob, err)
+		}
+
+		rebuildTriggers = append(rebuildTriggers, re)
+	}
+
+	return &Artifact{
 		Id:                    id,
 		Image:                 cfg.Image,
 		RootDir:               cfg.RootDir,
-		DockerIgnorePredicate: dockerIgnorePredicate,
+		ContextDir:            cfg.contextDir(as.rootDir),
+		syncRules:             syncRules,
+		rebuildTriggers:       rebuildTriggers,
+		dockerIgnorePredicate: dockerIgnorePredicate,
+		dockerIgnorePatterns:  dockerIgnorePatterns,
+		syncMappings:          syncMappings,
+	}, nil
+}
+
+// Reload rebuilds the ignore rules and sync mappings of the artifact and notifies subscribers
+// about the files whose ignore state has changed
+func (as *ArtifactService) Reload(id string) error {
+	as.mu.Lock()
+	artifact, ok := as.list[id]
+	cfg := as.cfgs[id]
+	as.mu.Unlock()
+
+	if !ok {
+		return ErrArtifactNotFound
+	}
+
+	newPredicate, newPatterns, err := as.buildDockerIgnorePredicate(cfg)
+	if err != nil {
+		return err
+	}
+
+	syncMappings, err := as.inferSyncMappings(cfg)
+	if err != nil {
+		return err
+	}
+
+	artifact.setSyncMappings(syncMappings)
+
+	oldPredicate, oldPatterns := artifact.dockerIgnore()
+
+	// Only the files under the changed patterns may switch the ignore state
+	walkRoots := changedPatternRoots(cfg.contextDir(as.rootDir), oldPatterns, newPatterns)
+
+	change, err := diffIgnoredFiles(walkRoots, oldPredicate, newPredicate)
+	if err != nil {
+		return err
 	}
+
+	artifact.setDockerIgnore(newPredicate, newPatterns)
+
+	if len(change.Included) == 0 && len(change.Excluded) == 0 {
+		return nil
+	}
+
+	change.ArtifactId = id
+
+	as.mu.Lock()
+	subscribers := as.subscribers
 	as.mu.Unlock()
 
+	for _, cb := range subscribers {
+		cb(change)
+	}
+
 	return nil
 }
 
-func (as *ArtifactService) FindById(id string) (Artifact, error) {
+func (as *ArtifactService) Subscribe(cb func(IgnoreChange)) {
+	as.mu.Lock()
+	as.subscribers = append(as.subscribers, cb)
+	as.mu.Unlock()
+}
+
+// List returns the registered artifacts sorted by id
+func (as *ArtifactService) List() []*Artifact {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	list := make([]*Artifact, 0, len(as.list))
+	for _, artifact := range as.list {
+		list = append(list, artifact)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+
+	return list
+}
+
+func (as *ArtifactService) FindById(id string) (*Artifact, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
 	artifact, ok := as.list[id]
 	if !ok {
-		return Artifact{}, ErrArtifactNotFound
+		return nil, ErrArtifactNotFound
+	}
+
+	return artifact, nil
+}
+
+// buildDockerIgnorePredicate returns the predicate and the patterns it is built of
+func (as *ArtifactService) buildDockerIgnorePredicate(cfg ArtifactConfig) (Predicate, []string, error) {
+	contextDir := cfg.contextDir(as.rootDir)
+
+	ignoreList, err := GetIgnoreList(contextDir, cfg.DockerfilePath())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	predicate, err := NewDockerIgnorePredicate(contextDir, ignoreList)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return predicate, ignoreList, nil
+}
+
+func (as *ArtifactService) inferSyncMappings(cfg ArtifactConfig) ([]SyncMapping, error) {
+	if len(cfg.RootDir) > 0 || len(cfg.Sync) > 0 {
+		return nil, nil
+	}
+
+	info, err := ParseDockerfile(cfg.DockerfilePath(), cfg.BuildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("root dir is not set and sync mappings can't be inferred: %w", err)
+	}
+
+	if len(info.Mappings) == 0 {
+		return nil, errors.New("root dir is not set and dockerfile has no COPY/ADD of build context files")
+	}
+
+	return info.Mappings, nil
+}
+
+func (as *ArtifactService) buildSyncRules(cfg ArtifactConfig) ([]syncRuleMatcher, error) {
+	if len(cfg.RootDir) > 0 || len(cfg.Sync) == 0 {
+		return nil, nil
+	}
+
+	workdir := "/"
+	for _, rule := range cfg.Sync {
+		if path.IsAbs(rule.Dest) {
+			continue
+		}
+
+		info, err := ParseDockerfile(cfg.DockerfilePath(), cfg.BuildArgs)
+		if err != nil {
+			return nil, fmt.Errorf("relative sync dest requires dockerfile WORKDIR: %w", err)
+		}
+
+		workdir = info.Workdir
+		break
+	}
+
+	return newSyncRuleMatchers(cfg.Sync, workdir)
+}
+
+func (as *ArtifactService) ignoreSources() map[string][]string {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	sources := make(map[string][]string)
+
+	for id, cfg := range as.cfgs {
+		artifactSources := GetIgnoreSources(cfg.contextDir(as.rootDir), cfg.DockerfilePath())
+		artifactSources = append(artifactSources, cfg.DockerfilePath())
+
+		for _, sourcePath := range artifactSources {
+			sources[sourcePath] = append(sources[sourcePath], id)
+		}
 	}
 
-	return *artifact, nil
+	return sources
 }
 
 func CheckArtifactsCfg(artifacts map[string]ArtifactConfig) error {
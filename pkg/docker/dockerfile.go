@@ -0,0 +1,263 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+)
+
+const DockerfileName = "Dockerfile"
+
+var (
+	ErrDockerfileStageNotFound = errors.New("dockerfile has no stages")
+)
+
+// SyncMapping is a local -> remote path pair taken from COPY/ADD instruction of the final stage
+type SyncMapping struct {
+	// Path (or glob pattern) relative to the build context
+	Src string
+	// Absolute path in the container
+	Dest      string
+	IsDestDir bool
+}
+
+func (sm SyncMapping) String() string {
+	dest := sm.Dest
+	if sm.IsDestDir && !strings.HasSuffix(dest, "/") {
+		dest += "/"
+	}
+
+	return fmt.Sprintf("%s -> %s", sm.Src, dest)
+}
+
+// DockerfileInfo is the part of the final stage of the dockerfile that matters for syncing
+type DockerfileInfo struct {
+	Workdir  string
+	Mappings []SyncMapping
+}
+
+// ParseDockerfile parses the dockerfile and returns the workdir and the mappings
+// of the build context files to the container paths of the final stage
+func ParseDockerfile(dockerfilePath string, buildArgs map[string]string) (DockerfileInfo, error) {
+	info := DockerfileInfo{}
+
+	f, err := os.Open(dockerfilePath)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+
+	result, err := parser.Parse(f)
+	if err != nil {
+		return info, err
+	}
+
+	stages, metaArgs, err := instructions.Parse(result.AST)
+	if err != nil {
+		return info, err
+	}
+
+	if len(stages) == 0 {
+		return info, ErrDockerfileStageNotFound
+	}
+
+	lex := shell.NewLex(result.EscapeToken)
+
+	metaEnv := make(map[string]string)
+	metaExpander := func(word string) (string, error) {
+		return lex.ProcessWordWithMap(word, metaEnv)
+	}
+
+	for _, metaArg := range metaArgs {
+		for _, kv := range metaArg.Args {
+			value, err := argValue(kv, buildArgs, nil, metaExpander)
+			if err != nil {
+				return info, err
+			}
+
+			metaEnv[kv.Key] = value
+		}
+	}
+
+	env := make(map[string]string)
+	expander := func(word string) (string, error) {
+		return lex.ProcessWordWithMap(word, env)
+	}
+
+	workdir := "/"
+	mappings := make([]SyncMapping, 0)
+
+	for _, cmd := range stages[len(stages)-1].Commands {
+		switch c := cmd.(type) {
+		case *instructions.ArgCommand:
+			for _, kv := range c.Args {
+				value, err := argValue(kv, buildArgs, metaEnv, expander)
+				if err != nil {
+					return info, err
+				}
+
+				env[kv.Key] = value
+			}
+		case *instructions.EnvCommand:
+			for _, kv := range c.Env {
+				value, err := expander(kv.Value)
+				if err != nil {
+					return info, err
+				}
+
+				env[kv.Key] = value
+			}
+		case *instructions.WorkdirCommand:
+			dir, err := expander(c.Path)
+			if err != nil {
+				return info, err
+			}
+
+			workdir = resolveContainerPath(workdir, dir)
+		case *instructions.CopyCommand:
+			if len(c.From) > 0 {
+				continue
+			}
+
+			newMappings, err := sourcesToMappings(c.SourcesAndDest, workdir, expander)
+			if err != nil {
+				return info, err
+			}
+
+			mappings = append(mappings, newMappings...)
+		case *instructions.AddCommand:
+			newMappings, err := sourcesToMappings(c.SourcesAndDest, workdir, expander)
+			if err != nil {
+				return info, err
+			}
+
+			mappings = append(mappings, newMappings...)
+		}
+	}
+
+	info.Workdir = workdir
+	info.Mappings = mappings
+
+	return info, nil
+}
+
+// ResolveRemotePath returns the container path of the local file, the last matched mapping wins
+func ResolveRemotePath(mappings []SyncMapping, contextDir, localPath string) (string, bool) {
+	relPath, err := filepath.Rel(contextDir, localPath)
+	if err != nil || isOutsideRel(relPath) {
+		return "", false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	parts := strings.Split(relPath, "/")
+
+	for i := len(mappings) - 1; i >= 0; i-- {
+		m := mappings[i]
+
+		if m.Src == "." {
+			return path.Join(m.Dest, relPath), true
+		}
+
+		for n := 1; n <= len(parts); n++ {
+			prefix := strings.Join(parts[:n], "/")
+
+			matched, err := path.Match(m.Src, prefix)
+			if err != nil || !matched {
+				continue
+			}
+
+			// Directory source: its content is copied into the destination
+			if n < len(parts) {
+				return path.Join(m.Dest, strings.Join(parts[n:], "/")), true
+			}
+
+			if m.IsDestDir {
+				return path.Join(m.Dest, parts[len(parts)-1]), true
+			}
+
+			return m.Dest, true
+		}
+	}
+
+	return "", false
+}
+
+func sourcesToMappings(sd instructions.SourcesAndDest, workdir string, expander func(string) (string, error)) ([]SyncMapping, error) {
+	mappings := make([]SyncMapping, 0, len(sd.SourcePaths))
+
+	// heredoc content is not a build context file
+	if len(sd.SourceContents) > 0 {
+		return mappings, nil
+	}
+
+	dest, err := expander(sd.DestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	isDestDir := strings.HasSuffix(dest, "/") || len(sd.SourcePaths) > 1
+	dest = resolveContainerPath(workdir, dest)
+
+	for _, src := range sd.SourcePaths {
+		src, err := expander(src)
+		if err != nil {
+			return nil, err
+		}
+
+		if isRemoteSource(src) {
+			continue
+		}
+
+		src = path.Clean("/" + filepath.ToSlash(src))[1:]
+		if len(src) == 0 {
+			src = "."
+		}
+
+		mappings = append(mappings, SyncMapping{
+			Src:       src,
+			Dest:      dest,
+			IsDestDir: isDestDir,
+		})
+	}
+
+	return mappings, nil
+}
+
+// argValue returns the build arg of the ARG, otherwise its default expanded like the ENV values
+// are, otherwise the global ARG of the same name
+func argValue(kv instructions.KeyValuePairOptional, buildArgs, metaEnv map[string]string, expander func(string) (string, error)) (string, error) {
+	if value, ok := buildArgs[kv.Key]; ok {
+		return value, nil
+	}
+
+	if kv.Value != nil {
+		return expander(*kv.Value)
+	}
+
+	return metaEnv[kv.Key], nil
+}
+
+func resolveContainerPath(workdir, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+
+	return path.Join(workdir, p)
+}
+
+func isRemoteSource(src string) bool {
+	return strings.HasPrefix(src, "http://") ||
+		strings.HasPrefix(src, "https://") ||
+		strings.HasPrefix(src, "git@")
+}
+
+func isOutsideRel(relPath string) bool {
+	return relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeDockerfile(t *testing.T, content string) string {
+	t.Helper()
+
+	dockerfilePath := filepath.Join(t.TempDir(), DockerfileName)
+	if err := os.WriteFile(dockerfilePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dockerfilePath
+}
+
+func TestParseDockerfileExpandsArgAndEnv(t *testing.T) {
+	dockerfilePath := writeDockerfile(t, `ARG BASE=/srv
+FROM php:8
+ARG BASE
+ARG APP_DIR=$BASE/app
+ENV CONF_DIR=$APP_DIR/conf
+WORKDIR $APP_DIR
+COPY src ./src
+COPY conf/*.ini ${CONF_DIR}/
+COPY a.php b.php lib
+`)
+
+	info, err := ParseDockerfile(dockerfilePath, map[string]string{"BASE": "/var/www"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Workdir != "/var/www/app" {
+		t.Errorf("Workdir = %q, want /var/www/app", info.Workdir)
+	}
+
+	want := []SyncMapping{
+		{Src: "src", Dest: "/var/www/app/src"},
+		{Src: "conf/*.ini", Dest: "/var/www/app/conf", IsDestDir: true},
+		{Src: "a.php", Dest: "/var/www/app/lib", IsDestDir: true},
+		{Src: "b.php", Dest: "/var/www/app/lib", IsDestDir: true},
+	}
+	if !reflect.DeepEqual(info.Mappings, want) {
+		t.Errorf("Mappings = %v, want %v", info.Mappings, want)
+	}
+}
+
+func TestParseDockerfileMetaArgDefault(t *testing.T) {
+	dockerfilePath := writeDockerfile(t, `ARG ROOT=/app
+FROM alpine
+ARG ROOT
+COPY . $ROOT
+`)
+
+	info, err := ParseDockerfile(dockerfilePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SyncMapping{{Src: ".", Dest: "/app"}}
+	if !reflect.DeepEqual(info.Mappings, want) {
+		t.Errorf("Mappings = %v, want %v", info.Mappings, want)
+	}
+}
+
+func TestParseDockerfileTakesFinalStageWithoutFrom(t *testing.T) {
+	dockerfilePath := writeDockerfile(t, `FROM node AS assets
+WORKDIR /build
+COPY assets ./assets
+
+FROM php:8
+WORKDIR /app
+COPY --from=assets /build/dist ./public
+COPY --from=composer:2 /usr/bin/composer /usr/bin/composer
+COPY src/ ./src/
+ADD https://example.com/file.txt /tmp/
+`)
+
+	info, err := ParseDockerfile(dockerfilePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Workdir != "/app" {
+		t.Errorf("Workdir = %q, want /app", info.Workdir)
+	}
+
+	want := []SyncMapping{{Src: "src", Dest: "/app/src", IsDestDir: true}}
+	if !reflect.DeepEqual(info.Mappings, want) {
+		t.Errorf("Mappings = %v, want %v", info.Mappings, want)
+	}
+}
+
+func TestResolveRemotePath(t *testing.T) {
+	contextDir := filepath.FromSlash("/ctx")
+	mappings := []SyncMapping{
+		{Src: ".", Dest: "/app"},
+		{Src: "config", Dest: "/etc/app"},
+		{Src: "config/app.ini", Dest: "/etc/app.ini"},
+		{Src: "*.php", Dest: "/app/public", IsDestDir: true},
+	}
+
+	tests := []struct {
+		localPath string
+		want      string
+		ok        bool
+	}{
+		// The last matched mapping wins
+		{"/ctx/config/app.ini", "/etc/app.ini", true},
+		{"/ctx/config/db.ini", "/etc/app/db.ini", true},
+		{"/ctx/index.php", "/app/public/index.php", true},
+		{"/ctx/src/index.php", "/app/src/index.php", true},
+		{"/other/index.php", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ResolveRemotePath(mappings, contextDir, filepath.FromSlash(tt.localPath))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ResolveRemotePath(%q) = %q, %v, want %q, %v", tt.localPath, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if _, ok := ResolveRemotePath(mappings[1:2], contextDir, filepath.FromSlash("/ctx/src/index.php")); ok {
+		t.Error("ResolveRemotePath() resolved the file no mapping matches")
+	}
+}
@@ -9,11 +9,7 @@ import (
 
 func GetIgnoreList(workspace string, absDockerfilePath string) ([]string, error) {
 	var excludes []string
-	dockerignorePaths := []string{
-		absDockerfilePath + ".dockerignore",
-		filepath.Join(workspace, ".dockerignore"),
-	}
-	for _, dockerignorePath := range dockerignorePaths {
+	for _, dockerignorePath := range GetIgnoreSources(workspace, absDockerfilePath) {
 		if _, err := os.Stat(dockerignorePath); !os.IsNotExist(err) {
 			r, err := os.Open(dockerignorePath)
 			if err != nil {
@@ -30,3 +26,11 @@ func GetIgnoreList(workspace string, absDockerfilePath string) ([]string, error)
 	}
 	return nil, nil
 }
+
+// GetIgnoreSources returns the .dockerignore candidates in order of priority
+func GetIgnoreSources(workspace string, absDockerfilePath string) []string {
+	return []string{
+		absDockerfilePath + ".dockerignore",
+		filepath.Join(workspace, ".dockerignore"),
+	}
+}
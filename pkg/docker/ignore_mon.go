@@ -0,0 +1,257 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rjeczalik/notify"
+)
+
+const ignoreReloadDebounce = time.Millisecond * 300
+
+// Listen watches the ignore sources of all registered artifacts and reloads
+// the ignore rules of the affected artifacts on change
+func (as *ArtifactService) Listen(ctx context.Context) error {
+	c := make(chan notify.EventInfo, 100)
+	defer notify.Stop(c)
+
+	watchedDirs := make(map[string]struct{})
+
+	sources, err := as.watchIgnoreSources(c, watchedDirs)
+	if err != nil {
+		return err
+	}
+
+	changedArtifacts := make(map[string]struct{})
+
+	timer := time.NewTimer(1<<63 - 1)
+	for {
+		select {
+		case e := <-c:
+			ids, ok := sources[e.Path()]
+			if !ok {
+				// The dir of the ignore sources is created, the sources in it are watched from now on
+				ids = sourcesUnder(sources, e.Path())
+				if len(ids) == 0 {
+					continue
+				}
+
+				if sources, err = as.watchIgnoreSources(c, watchedDirs); err != nil {
+					fmt.Printf("Watch ignore sources error: %s\n", err)
+				}
+			}
+
+			for _, id := range ids {
+				changedArtifacts[id] = struct{}{}
+			}
+
+			timer.Reset(ignoreReloadDebounce)
+		case <-timer.C:
+			for id := range changedArtifacts {
+				if err := as.Reload(id); err != nil {
+					fmt.Printf("Reload ignore rules of artifact \"%s\" error: %s\n", id, err)
+				}
+			}
+
+			changedArtifacts = make(map[string]struct{})
+		case <-as.sourcesChangedCh:
+			// The artifacts are updated, the dirs of the removed ones stay watched
+			if sources, err = as.watchIgnoreSources(c, watchedDirs); err != nil {
+				fmt.Printf("Watch ignore sources error: %s\n", err)
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// watchIgnoreSources adds the dirs of the ignore sources not watched yet and returns the sources.
+// The nearest existing parent of the missing dir is watched instead, its creation is seen there
+func (as *ArtifactService) watchIgnoreSources(c chan notify.EventInfo, watchedDirs map[string]struct{}) (map[string][]string, error) {
+	sources := as.ignoreSources()
+
+	for sourcePath := range sources {
+		dir := nearestExistingDir(filepath.Dir(sourcePath))
+		if _, ok := watchedDirs[dir]; ok {
+			continue
+		}
+
+		if err := notify.Watch(dir, c, notify.All); err != nil {
+			return sources, err
+		}
+
+		watchedDirs[dir] = struct{}{}
+	}
+
+	return sources, nil
+}
+
+// nearestExistingDir returns the dir or its nearest parent that exists
+func nearestExistingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+
+		dir = parent
+	}
+}
+
+// sourcesUnder returns the artifact ids of the ignore sources inside the dir
+func sourcesUnder(sources map[string][]string, dir string) []string {
+	ids := make([]string, 0)
+	for sourcePath, sourceIds := range sources {
+		if strings.HasPrefix(sourcePath, dir+string(filepath.Separator)) {
+			ids = append(ids, sourceIds...)
+		}
+	}
+
+	return ids
+}
+
+// changedPatternRoots returns the dirs and the files to walk for the ignore state changes, they are
+// the literal prefixes of the added and the removed patterns. The whole context dir is walked if a
+// changed pattern starts with a wildcard or the kept patterns are reordered, "!" exceptions depend on the order
+func changedPatternRoots(contextDir string, oldPatterns, newPatterns []string) []string {
+	oldSet := make(map[string]struct{}, len(oldPatterns))
+	for _, pattern := range oldPatterns {
+		oldSet[pattern] = struct{}{}
+	}
+
+	newSet := make(map[string]struct{}, len(newPatterns))
+	for _, pattern := range newPatterns {
+		newSet[pattern] = struct{}{}
+	}
+
+	changed := make([]string, 0)
+	keptOld := make([]string, 0, len(oldPatterns))
+	for _, pattern := range oldPatterns {
+		if _, ok := newSet[pattern]; !ok {
+			changed = append(changed, pattern)
+			continue
+		}
+
+		keptOld = append(keptOld, pattern)
+	}
+
+	keptNew := make([]string, 0, len(newPatterns))
+	for _, pattern := range newPatterns {
+		if _, ok := oldSet[pattern]; !ok {
+			changed = append(changed, pattern)
+			continue
+		}
+
+		keptNew = append(keptNew, pattern)
+	}
+
+	if !reflect.DeepEqual(keptOld, keptNew) {
+		return []string{contextDir}
+	}
+
+	roots := make([]string, 0, len(changed))
+	for _, pattern := range changed {
+		prefix := patternPrefix(strings.TrimPrefix(pattern, "!"))
+		if len(prefix) == 0 {
+			return []string{contextDir}
+		}
+
+		roots = append(roots, filepath.Join(contextDir, prefix))
+	}
+
+	// The roots nested in the other roots are walked with them
+	sort.Strings(roots)
+	walkRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if n := len(walkRoots); n > 0 {
+			last := walkRoots[n-1]
+			if root == last || strings.HasPrefix(root, last+string(filepath.Separator)) {
+				continue
+			}
+		}
+
+		walkRoots = append(walkRoots, root)
+	}
+
+	return walkRoots
+}
+
+// patternPrefix returns the leading path elements of the pattern without the wildcards
+func patternPrefix(pattern string) string {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+
+	prefix := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if strings.ContainsAny(elem, "*?[\\") {
+			break
+		}
+
+		prefix = append(prefix, elem)
+	}
+
+	return filepath.Join(prefix...)
+}
+
+func diffIgnoredFiles(walkRoots []string, oldPredicate, newPredicate Predicate) (IgnoreChange, error) {
+	change := IgnoreChange{
+		Included: make([]string, 0),
+		Excluded: make([]string, 0),
+	}
+
+	for _, root := range walkRoots {
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			wasIgnored, err := oldPredicate(path, nil)
+			if err != nil {
+				return err
+			}
+
+			isIgnored, err := newPredicate(path, nil)
+			if err != nil {
+				return err
+			}
+
+			if wasIgnored && !isIgnored {
+				change.Included = append(change.Included, path)
+			}
+
+			if !wasIgnored && isIgnored {
+				change.Excluded = append(change.Excluded, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return change, err
+		}
+	}
+
+	return change, nil
+}
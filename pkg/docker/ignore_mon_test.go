@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChangedPatternRoots(t *testing.T) {
+	contextDir := filepath.FromSlash("/ctx")
+	join := func(elems ...string) string {
+		return filepath.Join(append([]string{contextDir}, elems...)...)
+	}
+
+	tests := []struct {
+		name     string
+		old, new []string
+		want     []string
+	}{
+		{"unchanged", []string{"vendor", "*.log"}, []string{"vendor", "*.log"}, []string{}},
+		{"added", []string{"vendor"}, []string{"vendor", "var/cache"}, []string{join("var", "cache")}},
+		{"removed", []string{"vendor", "var/cache"}, []string{"var/cache"}, []string{join("vendor")}},
+		{"exception", []string{"logs"}, []string{"logs", "!logs/keep.log"}, []string{join("logs", "keep.log")}},
+		{"wildcard prefix", []string{"vendor"}, []string{"vendor", "src/*/tmp"}, []string{join("src")}},
+		{"leading wildcard", []string{"vendor"}, []string{"vendor", "*.log"}, []string{contextDir}},
+		{"nested roots", []string{}, []string{"var", "var/cache", "var2"}, []string{join("var"), join("var2")}},
+		// The "!" exceptions depend on the order of the kept patterns
+		{"reordered", []string{"a", "!a/b"}, []string{"!a/b", "a"}, []string{contextDir}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changedPatternRoots(contextDir, tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedPatternRoots(%v, %v) = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
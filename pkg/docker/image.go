@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultDomain    = "docker.io"
+	legacyDomain     = "index.docker.io"
+	officialRepoPath = "library/"
+)
+
+var (
+	imagePathComponentRe = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	imageTagRe           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigestRe        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// ImageRef is the image reference normalised the docker way: the registry domain defaults to docker.io
+// and the single-component paths of docker.io are official images under library/
+type ImageRef struct {
+	Domain string
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// Name returns the repository name of the image, without the tag and digest
+func (r ImageRef) Name() string {
+	return r.Domain + "/" + r.Path
+}
+
+// ParseImageRef parses the image reference [domain[:port]/]path[:tag][@digest]
+func ParseImageRef(image string) (ImageRef, error) {
+	var ref ImageRef
+
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !imageDigestRe.MatchString(ref.Digest) {
+			return ImageRef{}, fmt.Errorf("image \"%s\": invalid digest", image)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !imageTagRe.MatchString(ref.Tag) {
+			return ImageRef{}, fmt.Errorf("image \"%s\": invalid tag", image)
+		}
+	}
+
+	// The first component is the registry domain if it looks like a host, see docker/distribution
+	ref.Domain, ref.Path = defaultDomain, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first {
+			ref.Domain, ref.Path = first, name[i+1:]
+		}
+	}
+
+	if ref.Domain == legacyDomain {
+		ref.Domain = defaultDomain
+	}
+
+	if len(ref.Path) == 0 {
+		return ImageRef{}, fmt.Errorf("image \"%s\": empty repository name", image)
+	}
+
+	for _, component := range strings.Split(ref.Path, "/") {
+		if !imagePathComponentRe.MatchString(component) {
+			return ImageRef{}, fmt.Errorf("image \"%s\": invalid repository name", image)
+		}
+	}
+
+	if ref.Domain == defaultDomain && !strings.Contains(ref.Path, "/") {
+		ref.Path = officialRepoPath + ref.Path
+	}
+
+	return ref, nil
+}
+
+// ImageName cuts the tag and digest off the image reference
+func ImageName(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return image
+}
+
+// IsSameImage reports whether the running image is built from the artifact image: both are parsed
+// and their repository names compared, the tag and the digest are ignored. The artifact image pushed
+// under the default repo (skaffold --default-repo) matches too
+func IsSameImage(runningImage, artifactImage, defaultRepo string) bool {
+	running, err := ParseImageRef(runningImage)
+	if err != nil {
+		return false
+	}
+
+	artifact, err := ParseImageRef(artifactImage)
+	if err != nil {
+		return false
+	}
+
+	if running.Name() == artifact.Name() {
+		return true
+	}
+
+	if len(defaultRepo) == 0 {
+		return false
+	}
+
+	pushed, err := ParseImageRef(strings.TrimSuffix(defaultRepo, "/") + "/" + ImageName(artifactImage))
+	if err != nil {
+		return false
+	}
+
+	return running.Name() == pushed.Name()
+}
@@ -0,0 +1,59 @@
+package docker
+
+import "testing"
+
+func TestParseImageRef(t *testing.T) {
+	tests := []struct {
+		image string
+		want  ImageRef
+	}{
+		{"app", ImageRef{Domain: "docker.io", Path: "library/app"}},
+		{"app:abc", ImageRef{Domain: "docker.io", Path: "library/app", Tag: "abc"}},
+		{"team/app", ImageRef{Domain: "docker.io", Path: "team/app"}},
+		{"index.docker.io/library/app", ImageRef{Domain: "docker.io", Path: "library/app"}},
+		{"localhost/app", ImageRef{Domain: "localhost", Path: "app"}},
+		{"localhost:5000/team/app:1.0", ImageRef{Domain: "localhost:5000", Path: "team/app", Tag: "1.0"}},
+		{"gcr.io/proj/app@sha256:0123456789abcdef0123456789abcdef", ImageRef{Domain: "gcr.io", Path: "proj/app", Digest: "sha256:0123456789abcdef0123456789abcdef"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseImageRef(tt.image)
+		if err != nil {
+			t.Errorf("ParseImageRef(%q) error = %v", tt.image, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseImageRef(%q) = %+v, want %+v", tt.image, got, tt.want)
+		}
+	}
+
+	for _, image := range []string{"", "App", "app:", "team//app", "app@sha256:xyz"} {
+		if _, err := ParseImageRef(image); err == nil {
+			t.Errorf("ParseImageRef(%q) error = nil, want an error", image)
+		}
+	}
+}
+
+func TestIsSameImage(t *testing.T) {
+	tests := []struct {
+		running, artifact, defaultRepo string
+		want                           bool
+	}{
+		{"app:abc", "app", "", true},
+		{"docker.io/library/app:abc", "app", "", true},
+		{"app@sha256:0123456789abcdef0123456789abcdef", "app:latest", "", true},
+		{"evil.io/team/app", "app", "", false},
+		{"team/app", "app", "", false},
+		{"registry.io/team/app:abc", "app", "registry.io/team", true},
+		{"registry.io/team/app:abc", "app", "registry.io/team/", true},
+		{"evil.io/team/app", "app", "registry.io/team", false},
+		{"app-other", "app", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSameImage(tt.running, tt.artifact, tt.defaultRepo); got != tt.want {
+			t.Errorf("IsSameImage(%q, %q, %q) = %v, want %v", tt.running, tt.artifact, tt.defaultRepo, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package docker
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SyncRule is a manual sync rule in the skaffold format
+type SyncRule struct {
+	// Glob pattern relative to the build context, supports "**"
+	Src string
+	// Path in the container, relative paths are resolved against the dockerfile WORKDIR
+	Dest string
+	// Prefix removed from the file path before joining with Dest
+	Strip string
+}
+
+func (sr SyncRule) String() string {
+	if len(sr.Strip) == 0 {
+		return fmt.Sprintf("%s -> %s", sr.Src, sr.Dest)
+	}
+
+	return fmt.Sprintf("%s -> %s (strip %s)", sr.Src, sr.Dest, sr.Strip)
+}
+
+type syncRuleMatcher struct {
+	rule SyncRule
+	re   *regexp.Regexp
+}
+
+func newSyncRuleMatchers(rules []SyncRule, workdir string) ([]syncRuleMatcher, error) {
+	matchers := make([]syncRuleMatcher, 0, len(rules))
+
+	for _, rule := range rules {
+		re, err := globToRegexp(rule.Src)
+		if err != nil {
+			return nil, err
+		}
+
+		rule.Dest = resolveContainerPath(workdir, rule.Dest)
+
+		matchers = append(matchers, syncRuleMatcher{rule, re})
+	}
+
+	return matchers, nil
+}
+
+// resolveSyncRules returns the container path of the local file, the first matched rule wins
+func resolveSyncRules(matchers []syncRuleMatcher, contextDir, localPath string) (string, bool) {
+	relPath, err := filepath.Rel(contextDir, localPath)
+	if err != nil || isOutsideRel(relPath) {
+		return "", false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+
+	for _, m := range matchers {
+		if !m.re.MatchString(relPath) {
+			continue
+		}
+
+		return path.Join(m.rule.Dest, strings.TrimPrefix(relPath, m.rule.Strip)), true
+	}
+
+	return "", false
+}
+
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimPrefix(filepath.ToSlash(glob), "./")
+
+	buf := strings.Builder{}
+	buf.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			buf.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case c == '*':
+			buf.WriteString("[^/]*")
+		case c == '?':
+			buf.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				buf.WriteString(regexp.QuoteMeta(glob[i:]))
+				i = len(glob)
+				continue
+			}
+
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			buf.WriteString("[" + class + "]")
+			i += end
+		case c == '{':
+			end := strings.IndexByte(glob[i:], '}')
+			if end < 0 {
+				buf.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+
+			alternatives := strings.Split(glob[i+1:i+end], ",")
+			for j := range alternatives {
+				alternatives[j] = regexp.QuoteMeta(alternatives[j])
+			}
+
+			buf.WriteString("(" + strings.Join(alternatives, "|") + ")")
+			i += end
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	buf.WriteString("$")
+
+	return regexp.Compile(buf.String())
+}
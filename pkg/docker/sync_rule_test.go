@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.php", "index.php", true},
+		{"*.php", "src/index.php", false},
+		{"src/*.php", "src/index.php", true},
+		{"src/*.php", "src/lib/index.php", false},
+		{"**/*.php", "index.php", true},
+		{"**/*.php", "src/lib/index.php", true},
+		{"src/**/*.php", "src/index.php", true},
+		{"src/**/*.php", "src/a/b/index.php", true},
+		{"src/**/*.php", "lib/index.php", false},
+		{"src/**", "src/a/b.txt", true},
+		{"./src/*.php", "src/index.php", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"file[0-9].txt", "file1.txt", true},
+		{"file[0-9].txt", "filea.txt", false},
+		{"file[!0-9].txt", "filea.txt", true},
+		{"file[!0-9].txt", "file1.txt", false},
+		{"*.{css,js}", "app.js", true},
+		{"*.{css,js}", "app.ts", false},
+		{"a.b", "axb", false},
+		{"file[.txt", "file[.txt", true},
+	}
+
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Errorf("globToRegexp(%q) error = %v", tt.glob, err)
+			continue
+		}
+
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("globToRegexp(%q) matches %q = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSyncRulesFirstRuleWins(t *testing.T) {
+	matchers, err := newSyncRuleMatchers([]SyncRule{
+		{Src: "src/public/**", Dest: "/var/www/public", Strip: "src/public/"},
+		{Src: "src/**", Dest: "app", Strip: "src/"},
+		{Src: "**/*.php", Dest: "/unused"},
+	}, "/srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contextDir := filepath.FromSlash("/ctx")
+	tests := []struct {
+		localPath string
+		want      string
+		ok        bool
+	}{
+		{"/ctx/src/public/index.php", "/var/www/public/index.php", true},
+		// The relative Dest is resolved against the workdir
+		{"/ctx/src/lib/util.php", "/srv/app/lib/util.php", true},
+		{"/ctx/index.php", "/unused/index.php", true},
+		{"/ctx/README.md", "", false},
+		{"/other/src/index.php", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := resolveSyncRules(matchers, contextDir, filepath.FromSlash(tt.localPath))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("resolveSyncRules(%q) = %q, %v, want %q, %v", tt.localPath, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// historySize is how many last events are kept to resume the streams
+	historySize = 1000
+	// subscriberBuffer is how many events the subscriber may lag behind before it is dropped
+	subscriberBuffer = 256
+)
+
+// Event is the envelope of every published event, Seq grows by one with every event of the run,
+// Run tells the runs apart as Seq starts over with every one
+type Event struct {
+	Run  string      `json:"run"`
+	Seq  uint64      `json:"seq"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Hub numbers the events, keeps the last ones and fans them out to the subscribers.
+// The subscriber that can't keep up is dropped, it resumes from its last event
+type Hub struct {
+	// run is the random id of the run, the resumed stream of another run is replayed from the start
+	run string
+
+	mu          sync.Mutex
+	seq         uint64
+	history     []Event
+	subscribers map[chan Event]struct{}
+
+	// lastSkaffoldStatus is compared with the probed one to publish the transitions only
+	lastSkaffoldStatus *SkaffoldStatus
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		run:         newRunId(),
+		history:     make([]Event, 0, historySize),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+func (h *Hub) Publish(eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e := Event{
+		Run:  h.run,
+		Seq:  h.seq,
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+
+	if len(h.history) == historySize {
+		h.history = h.history[1:]
+	}
+	h.history = append(h.history, e)
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the channel of the events published from now on, the channel is closed
+// if the subscriber lags behind. cancel must be called once the events are not read anymore
+func (h *Hub) Subscribe() (ch chan Event, cancel func()) {
+	_, ch, cancel = h.subscribe(false, "", 0)
+	return ch, cancel
+}
+
+// SubscribeSince is Subscribe that returns the kept events after the seq as well. The seq
+// gap between the seq and the first returned event means the events are not kept anymore.
+// The seq of another run (the watcher is restarted) or the one not reached yet resumes
+// from the start of the kept events, an empty run is the current one
+func (h *Hub) SubscribeSince(run string, seq uint64) (missed []Event, ch chan Event, cancel func()) {
+	return h.subscribe(true, run, seq)
+}
+
+// Run returns the id of the run the events are numbered in
+func (h *Hub) Run() string {
+	return h.run
+}
+
+func (h *Hub) subscribe(isResume bool, run string, seq uint64) ([]Event, chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if (len(run) > 0 && run != h.run) || seq > h.seq {
+		seq = 0
+	}
+
+	missed := make([]Event, 0)
+	if isResume {
+		for _, e := range h.history {
+			if e.Seq > seq {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return missed, ch, cancel
+}
+
+// newRunId falls back to the start time if the random source fails, the ids only have to differ between the runs
+func newRunId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return hex.EncodeToString(b)
+}
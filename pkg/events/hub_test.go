@@ -0,0 +1,109 @@
+package events
+
+import "testing"
+
+func seqs(events []Event) []uint64 {
+	result := make([]uint64, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.Seq)
+	}
+
+	return result
+}
+
+func TestSubscribeSinceReplaysAfterCursor(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < 5; i++ {
+		h.Publish("test", i)
+	}
+
+	missed, ch, cancel := h.SubscribeSince(h.Run(), 3)
+	defer cancel()
+
+	if got := seqs(missed); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Errorf("missed events = %v, want [4 5]", got)
+	}
+
+	h.Publish("test", 5)
+	if e := <-ch; e.Seq != 6 || e.Run != h.Run() {
+		t.Errorf("streamed event = %+v, want seq 6 of the run", e)
+	}
+}
+
+func TestSubscribeSinceReplaysFromStartOfAnotherRun(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < 3; i++ {
+		h.Publish("test", i)
+	}
+
+	for _, tt := range []struct {
+		name string
+		run  string
+		seq  uint64
+	}{
+		{"another run", "restarted", 2},
+		{"seq not reached", h.Run(), 10},
+	} {
+		missed, _, cancel := h.SubscribeSince(tt.run, tt.seq)
+		cancel()
+
+		if got := seqs(missed); len(got) != 3 || got[0] != 1 {
+			t.Errorf("%s: missed events = %v, want [1 2 3]", tt.name, got)
+		}
+	}
+
+	// The empty run is the current one
+	missed, _, cancel := h.SubscribeSince("", 2)
+	cancel()
+
+	if got := seqs(missed); len(got) != 1 || got[0] != 3 {
+		t.Errorf("missed events of the empty run = %v, want [3]", got)
+	}
+}
+
+func TestHistoryKeepsLastEvents(t *testing.T) {
+	h := NewHub()
+	for i := 0; i < historySize+10; i++ {
+		h.Publish("test", i)
+	}
+
+	missed, _, cancel := h.SubscribeSince(h.Run(), 0)
+	cancel()
+
+	// The gap after the cursor tells the events are not kept anymore
+	if len(missed) != historySize || missed[0].Seq != 11 {
+		t.Errorf("%d missed events from seq %d, want %d from seq 11", len(missed), missed[0].Seq, historySize)
+	}
+}
+
+func TestLaggingSubscriberIsDropped(t *testing.T) {
+	h := NewHub()
+
+	lagging, cancelLagging := h.Subscribe()
+	defer cancelLagging()
+
+	reading, cancelReading := h.Subscribe()
+	defer cancelReading()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		h.Publish("test", i)
+		<-reading
+	}
+
+	received := 0
+	for range lagging {
+		received++
+	}
+
+	if received != subscriberBuffer {
+		t.Errorf("lagging subscriber received %d events before the close, want %d", received, subscriberBuffer)
+	}
+
+	h.Publish("test", "after")
+	if e, ok := <-reading; !ok || e.Data != "after" {
+		t.Errorf("reading subscriber got %+v, %v, want the next event", e, ok)
+	}
+
+	// cancel of the dropped subscriber does nothing
+	cancelLagging()
+}
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"reflect"
+	"skasync/pkg/filemon"
+	"skasync/pkg/k8s"
+	"skasync/pkg/skaffold"
+	"skasync/pkg/sync"
+)
+
+// The event types, the data of every type keeps its JSON schema, the fields are only added
+const (
+	TypeChangeBatch     = "change.batch"
+	TypeSyncStarted     = "sync.started"
+	TypeSyncFinished    = "sync.finished"
+	TypeSyncFailed      = "sync.failed"
+	TypeSkaffoldStatus  = "skaffold.status"
+	TypeEndpointChanged = "endpoint.changed"
+)
+
+// ChangeBatch is the debounced change list of the gateway by the provider, e.g. fs, git.checkout
+type ChangeBatch struct {
+	Providers map[string]ChangeCounts `json:"providers"`
+}
+
+type ChangeCounts struct {
+	Added    int `json:"added"`
+	Modified int `json:"modified"`
+	Deleted  int `json:"deleted"`
+}
+
+// SyncStarted is the sync of the change batch to the endpoint, the counts are the files
+// left after the ignore rules and the mappings
+type SyncStarted struct {
+	Tag     string `json:"tag"`
+	Pod     string `json:"pod"`
+	Copied  int    `json:"copied"`
+	Deleted int    `json:"deleted"`
+}
+
+// SyncFinished is the data of both the sync.finished and the sync.failed events
+type SyncFinished struct {
+	Tag        string `json:"tag"`
+	Pod        string `json:"pod"`
+	DurationMs int64  `json:"durationMs"`
+	Copied     int    `json:"copied"`
+	Deleted    int    `json:"deleted"`
+	Bytes      int64  `json:"bytes"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SkaffoldStatus struct {
+	Ready         bool            `json:"ready"`
+	DoesNotAnswer bool            `json:"doesNotAnswer"`
+	Deploy        string          `json:"deploy"`
+	Artifacts     map[string]bool `json:"artifacts"`
+}
+
+// EndpointChanged is the endpoint bound to the pod, taken off the pod or removed from the config
+type EndpointChanged struct {
+	Tag       string `json:"tag"`
+	Context   string `json:"context"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	PrevPod   string `json:"prevPod"`
+	Reason    string `json:"reason"`
+	Removed   bool   `json:"removed"`
+}
+
+func (h *Hub) ChangeBatchHandler(m map[string]filemon.ChangeList) {
+	batch := ChangeBatch{Providers: make(map[string]ChangeCounts, len(m))}
+	for providerName, cl := range m {
+		batch.Providers[providerName] = ChangeCounts{
+			Added:    len(cl.Added()),
+			Modified: len(cl.Modified()),
+			Deleted:  len(cl.Deleted()),
+		}
+	}
+
+	h.Publish(TypeChangeBatch, batch)
+}
+
+func (h *Hub) SyncStartHandler(start sync.SyncStart) {
+	h.Publish(TypeSyncStarted, SyncStarted{
+		Tag:     start.TagName,
+		Pod:     start.Location,
+		Copied:  start.Copied,
+		Deleted: start.Deleted,
+	})
+}
+
+// SyncResultHandler publishes the finished and the failed syncs, the syncs of nothing are skipped
+func (h *Hub) SyncResultHandler(result sync.SyncResult) {
+	if result.Copied+result.Deleted == 0 && result.Err == nil {
+		return
+	}
+
+	finished := SyncFinished{
+		Tag:        result.TagName,
+		Pod:        result.Location,
+		DurationMs: result.Duration.Milliseconds(),
+		Copied:     result.Copied,
+		Deleted:    result.Deleted,
+		Bytes:      result.Bytes,
+	}
+
+	if result.Err != nil {
+		finished.Error = result.Err.Error()
+		h.Publish(TypeSyncFailed, finished)
+		return
+	}
+
+	h.Publish(TypeSyncFinished, finished)
+}
+
+// SkaffoldStatusHandler publishes the probed status if it differs from the last one
+func (h *Hub) SkaffoldStatusHandler(status skaffold.SkaffoldProcessStatus) {
+	next := SkaffoldStatus{
+		Ready:         status.IsReady,
+		DoesNotAnswer: status.DoesNotAnswer,
+		Deploy:        status.Deploy,
+		Artifacts:     status.ReadyArtifacts,
+	}
+	if next.Artifacts == nil {
+		next.Artifacts = make(map[string]bool)
+	}
+
+	h.mu.Lock()
+	isChanged := h.lastSkaffoldStatus == nil || !reflect.DeepEqual(*h.lastSkaffoldStatus, next)
+	h.lastSkaffoldStatus = &next
+	h.mu.Unlock()
+
+	if isChanged {
+		h.Publish(TypeSkaffoldStatus, next)
+	}
+}
+
+func (h *Hub) EndpointHandler(e k8s.EndpointEvent) {
+	h.Publish(TypeEndpointChanged, EndpointChanged{
+		Tag:       e.TagName,
+		Context:   e.Context,
+		Namespace: e.Namespace,
+		Pod:       e.PodName,
+		PrevPod:   e.PrevPodName,
+		Reason:    e.Reason,
+		Removed:   e.IsRemoved,
+	})
+}
@@ -13,6 +13,9 @@ type ChangeList struct {
 	added    map[string]fs.FileInfo
 	modified map[string]fs.FileInfo
 	deleted  map[string]time.Time
+	// excluded are the files excluded by the reloaded ignore rules of the artifact, by the artifact id.
+	// They are deleted from the pods of the artifact although they exist
+	excluded map[string]map[string]time.Time
 }
 
 func NewChangeList() ChangeList {
@@ -21,6 +24,7 @@ func NewChangeList() ChangeList {
 		added:    make(map[string]fs.FileInfo),
 		modified: make(map[string]fs.FileInfo),
 		deleted:  make(map[string]time.Time),
+		excluded: make(map[string]map[string]time.Time),
 	}
 }
 
@@ -56,6 +60,15 @@ func (cl *ChangeList) Deleted() map[string]time.Time {
 	return list
 }
 
+// Excluded returns the files excluded by the ignore rules of the artifact
+func (cl *ChangeList) Excluded(artifactId string) []string {
+	list := make([]string, 0, len(cl.excluded[artifactId]))
+	for path := range cl.excluded[artifactId] {
+		list = append(list, path)
+	}
+	return list
+}
+
 func (cl *ChangeList) AddAdded(filePath string, info fs.FileInfo) {
 	cl.mu.Lock()
 	cl.added[filePath] = info
@@ -92,6 +105,15 @@ func (cl *ChangeList) RemoveDeleted(filePath string) {
 	cl.mu.Unlock()
 }
 
+func (cl *ChangeList) AddExcluded(artifactId, filePath string, t time.Time) {
+	cl.mu.Lock()
+	if _, ok := cl.excluded[artifactId]; !ok {
+		cl.excluded[artifactId] = make(map[string]time.Time)
+	}
+	cl.excluded[artifactId][filePath] = t
+	cl.mu.Unlock()
+}
+
 func (cl *ChangeList) Union(list ChangeList) ChangeList {
 	for filePath, fi := range list.added {
 		cl.AddAdded(filePath, fi)
@@ -105,11 +127,22 @@ func (cl *ChangeList) Union(list ChangeList) ChangeList {
 		cl.AddDeleted(filePath, t)
 	}
 
+	for artifactId, files := range list.excluded {
+		for filePath, t := range files {
+			cl.AddExcluded(artifactId, filePath, t)
+		}
+	}
+
 	return *cl
 }
 
 func (cl *ChangeList) CountAll() int {
-	return len(cl.added) + len(cl.modified) + len(cl.deleted)
+	count := len(cl.added) + len(cl.modified) + len(cl.deleted)
+	for _, files := range cl.excluded {
+		count += len(files)
+	}
+
+	return count
 }
 
 func (cl *ChangeList) AddedList() []string {
@@ -149,6 +182,10 @@ func (cl *ChangeList) AllFilePathsList() []string {
 	list = append(list, cl.ModifiedList()...)
 	list = append(list, cl.DeletedList()...)
 
+	for artifactId := range cl.excluded {
+		list = append(list, cl.Excluded(artifactId)...)
+	}
+
 	return list
 }
 
@@ -52,9 +52,10 @@ func (g *Gateway) RegisterProvider(ctx context.Context, name string, ch chan Cha
 					changeList = changeList.Union(buffList)
 				}
 				g.buffer[name] = changeList
+				debounce := g.debounce
 				g.mu.Unlock()
 
-				g.timer.Reset(time.Millisecond * time.Duration(g.debounce))
+				g.timer.Reset(time.Millisecond * time.Duration(debounce))
 			case <-ctx.Done():
 				return
 			}
@@ -62,6 +63,13 @@ func (g *Gateway) RegisterProvider(ctx context.Context, name string, ch chan Cha
 	}()
 }
 
+// SetDebounce changes the debounce of the next changes
+func (g *Gateway) SetDebounce(debounce int) {
+	g.mu.Lock()
+	g.debounce = debounce
+	g.mu.Unlock()
+}
+
 func (g *Gateway) Subscribe(cb func(map[string]ChangeList)) {
 	g.mu.Lock()
 	g.subscribers = append(g.subscribers, cb)
@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/rjeczalik/notify"
@@ -11,6 +13,9 @@ import (
 
 type Watcher struct {
 	rootDir   string
+	excluded map[string]struct{}
+
+	mu       sync.Mutex
 	debounce int
 }
 
@@ -18,9 +23,22 @@ func NewWatcher(rootDir string, debounce int) *Watcher {
 	return &Watcher{
 		rootDir:   rootDir,
 		debounce: debounce,
+		excluded: make(map[string]struct{}),
+	}
+}
+
+// Exclude skips the events of the files, e.g. the files written by skasync itself
+func (w *Watcher) Exclude(filePaths ...string) {
+	for _, filePath := range filePaths {
+		w.excluded[filepath.Clean(filePath)] = struct{}{}
 	}
 }
 
+func (w *Watcher) isExcluded(filePath string) bool {
+	_, ok := w.excluded[filepath.Clean(filePath)]
+	return ok
+}
+
 func (w *Watcher) Watch(ctx context.Context, outCh chan []string) error {
 	c := make(chan notify.EventInfo, 100)
 
@@ -32,21 +50,16 @@ func (w *Watcher) Watch(ctx context.Context, outCh chan []string) error {
 
 	changeFiles := make([]string, 0)
 
-	d := time.Duration(0)
-	if (w.debounce > 0) {
-		d = time.Millisecond * time.Duration(w.debounce / 2)
-	}
-
 	timer := time.NewTimer(1<<63 - 1)
 	for {
 		select {
 		case e := <-c:
-			if e == nil {
+			if e == nil || w.isExcluded(e.Path()) {
 				continue
 			}
 
 			changeFiles = append(changeFiles, e.Path())
-			timer.Reset(d)
+			timer.Reset(w.delay())
 		case <-timer.C:
 			// send change list
 			outCh <- changeFiles
@@ -58,6 +71,25 @@ func (w *Watcher) Watch(ctx context.Context, outCh chan []string) error {
 	}
 }
 
+// SetDebounce changes the debounce of the next changes
+func (w *Watcher) SetDebounce(debounce int) {
+	w.mu.Lock()
+	w.debounce = debounce
+	w.mu.Unlock()
+}
+
+// delay is the half of the debounce, the gateway waits for the other half
+func (w *Watcher) delay() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.debounce <= 0 {
+		return 0
+	}
+
+	return time.Millisecond * time.Duration(w.debounce/2)
+}
+
 func ConvertFilesToChangeList(files []string) ChangeList {
 	list := NewChangeList()
 
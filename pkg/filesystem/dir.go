@@ -0,0 +1,13 @@
+package filesystem
+
+import "os"
+
+// MkdirPrivate creates the directory readable by the user only. The directory is shared by the
+// journal and the API token, so the mode of the one created by an older run is narrowed too
+func MkdirPrivate(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	return os.Chmod(dir, 0700)
+}
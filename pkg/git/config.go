@@ -0,0 +1,13 @@
+package git
+
+// Config is the Git section of the config file, it is read so the documented configs pass the validation
+type Config struct {
+	// Turns on git state tracking, the checkout monitor is started regardless of it for now
+	EnableWatching bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		EnableWatching: true,
+	}
+}
@@ -0,0 +1,269 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"skasync/pkg/cli"
+	"skasync/pkg/docker"
+	"strings"
+	"time"
+)
+
+const (
+	// AnnotationIgnore set to "true" excludes the pod from the discovery
+	AnnotationIgnore = "skasync.io/ignore"
+	// AnnotationIgnoreContainers is the comma-separated list of the pod containers excluded from the discovery
+	AnnotationIgnoreContainers = "skasync.io/ignore-containers"
+)
+
+// DiscoveryConfig turns on the endpoints discovery: every container of the pods in the namespace
+// whose image matches an artifact image becomes an endpoint named after its workload
+type DiscoveryConfig struct {
+	Enabled bool
+	// DefaultRepo is the registry prefix the artifact images are pushed under (skaffold --default-repo)
+	DefaultRepo string
+}
+
+type discoveredEndpoint struct {
+	Container string
+	Artifact  *docker.Artifact
+}
+
+// watchDiscovery watches all pods of the global namespace, the broken watch is restarted
+func (pc *EndpointCtrl) watchDiscovery(ctx context.Context) {
+	epCli := pc.cliPool.Get("", "")
+	kubeCtl := cli.NewKubeCtl(epCli)
+	backoff := minWatchBackoff
+
+	for {
+		if !pc.resetDiscoveredPods(ctx) {
+			return
+		}
+
+		startedAt := time.Now()
+		err := kubeCtl.WatchPods(ctx, "", func(e cli.PodEvent) {
+			pc.handleDiscoveredPodEvent(ctx, epCli, e)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(startedAt) > maxWatchBackoff {
+			backoff = minWatchBackoff
+		}
+
+		fmt.Printf("Pods discovery watch (%s) is broken, restarting in %s: %s\n", epCli, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+// discover lists the pods once, used without the watch
+func (pc *EndpointCtrl) discover() error {
+	epCli := pc.cliPool.Get("", "")
+
+	pods, err := cli.NewKubeCtl(epCli).GetPods("")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pc.resetDiscoveredPods(ctx)
+
+	for _, pod := range pods {
+		pc.handleDiscoveredPodEvent(ctx, epCli, cli.PodEvent{Type: cli.PodEventAdded, Object: pod})
+	}
+
+	// The endpoints discovered by the previous listing whose pods are gone
+	pc.mu.Lock()
+	events := make([]EndpointEvent, 0)
+	for tagName, d := range pc.discovered {
+		if len(pc.pods[tagName]) == 0 {
+			events = append(events, pc.removeDiscovered(tagName, d, epCli))
+		}
+	}
+	pc.mu.Unlock()
+
+	for _, event := range events {
+		pc.publish(event)
+	}
+
+	return nil
+}
+
+// removeDiscovered drops the discovered endpoint without pods, must be called with the lock held
+func (pc *EndpointCtrl) removeDiscovered(tagName string, d discoveredEndpoint, epCli *cli.CLI) EndpointEvent {
+	event := pc.unbind(tagName, d.Artifact.Id, epCli, []string{d.Container}, "no pod runs the artifact image anymore")
+	event.IsRemoved = true
+	delete(pc.discovered, tagName)
+	delete(pc.states, tagName)
+
+	return event
+}
+
+// resetDiscoveredPods returns false if the discovery is stopped, see Update
+func (pc *EndpointCtrl) resetDiscoveredPods(ctx context.Context) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	for tagName := range pc.discovered {
+		pc.pods[tagName] = make(map[string]cli.Pod)
+	}
+
+	return true
+}
+
+func (pc *EndpointCtrl) handleDiscoveredPodEvent(ctx context.Context, epCli *cli.CLI, e cli.PodEvent) {
+	pod := e.Object
+	podName := pod.Metadata.Name
+
+	pc.mu.Lock()
+
+	if ctx.Err() != nil {
+		pc.mu.Unlock()
+		return
+	}
+
+	// The pod is taken off every discovered endpoint and put back to the matching ones
+	affected := make(map[string]discoveredEndpoint)
+	for tagName, d := range pc.discovered {
+		if _, ok := pc.pods[tagName][podName]; ok {
+			delete(pc.pods[tagName], podName)
+			affected[tagName] = d
+		}
+	}
+
+	if e.Type != cli.PodEventDeleted && pod.Metadata.Annotations[AnnotationIgnore] != "true" {
+		for tagName, d := range pc.matchPod(epCli, pod) {
+			if _, ok := pc.pods[tagName]; !ok {
+				pc.pods[tagName] = make(map[string]cli.Pod)
+			}
+
+			pc.discovered[tagName] = d
+			pc.pods[tagName][podName] = pod
+			affected[tagName] = d
+		}
+	}
+
+	events := make([]EndpointEvent, 0)
+	for tagName, d := range affected {
+		// The discovered endpoint goes away with its last pod
+		if len(pc.pods[tagName]) == 0 {
+			events = append(events, pc.removeDiscovered(tagName, d, epCli))
+			continue
+		}
+
+		if event, isChanged := pc.bind(tagName, []string{d.Container}, d.Artifact, epCli); isChanged {
+			events = append(events, event)
+		}
+	}
+
+	pc.mu.Unlock()
+
+	for _, event := range events {
+		pc.publish(event)
+	}
+}
+
+// matchPod returns the endpoints of the pod containers running the artifact images. The containers
+// of the configured endpoints are skipped, must be called with the lock held
+func (pc *EndpointCtrl) matchPod(epCli *cli.CLI, pod cli.Pod) map[string]discoveredEndpoint {
+	ignored := make(map[string]struct{})
+	for _, name := range strings.Split(pod.Metadata.Annotations[AnnotationIgnoreContainers], ",") {
+		ignored[strings.TrimSpace(name)] = struct{}{}
+	}
+
+	matched := make(map[string]discoveredEndpoint)
+
+	for _, container := range pod.Spec.Containers {
+		if _, ok := ignored[container.Name]; ok {
+			continue
+		}
+
+		artifact := pc.findArtifactByImage(container.Image)
+		if artifact == nil || pc.isConfiguredContainer(epCli, pod, container.Name) {
+			continue
+		}
+
+		tagName := pod.WorkloadName()
+		if len(pod.Spec.Containers) > 1 {
+			tagName += "-" + container.Name
+		}
+
+		// The configured endpoint of the same name wins
+		if _, ok := pc.epsCfg[tagName]; ok {
+			continue
+		}
+
+		matched[tagName] = discoveredEndpoint{
+			Container: container.Name,
+			Artifact:  artifact,
+		}
+	}
+
+	return matched
+}
+
+func (pc *EndpointCtrl) findArtifactByImage(image string) *docker.Artifact {
+	for _, artifact := range pc.artifactService.List() {
+		if docker.IsSameImage(image, artifact.Image, pc.discoveryCfg.DefaultRepo) {
+			return artifact
+		}
+	}
+
+	return nil
+}
+
+// isConfiguredContainer reports whether the container belongs to a configured endpoint of the same
+// context and namespace: the endpoint is bound to the pod, or its selector matches the pod labels.
+// The endpoint whose workload selector isn't resolved yet claims the containers of its names, so
+// discovery doesn't take them first. Must be called with the lock held
+func (pc *EndpointCtrl) isConfiguredContainer(epCli *cli.CLI, pod cli.Pod, container string) bool {
+	for tagName, epCfg := range pc.epsCfg {
+		if pc.cliPool.Get(epCfg.Context, epCfg.Namespace) != epCli || !hasContainer(epCfg.ContainerNames(), container) {
+			continue
+		}
+
+		if ep, ok := pc.endpoints[tagName]; ok && ep.PodName == pod.Metadata.Name {
+			return true
+		}
+
+		selector, ok := pc.selectors[tagName]
+		if !ok {
+			if kind, _ := epCfg.Workload(); len(kind) > 0 {
+				return true
+			}
+
+			selector = epCfg.Selector
+		}
+
+		if matchesSelector(selector, pod.Metadata.Labels) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasContainer(containers []string, container string) bool {
+	for _, name := range containers {
+		if name == container {
+			return true
+		}
+	}
+
+	return false
+}
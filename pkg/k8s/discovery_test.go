@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"skasync/pkg/cli"
+	"skasync/pkg/docker"
+	"testing"
+)
+
+func newTestPod(t *testing.T, name, app, image string) cli.Pod {
+	t.Helper()
+
+	var pod cli.Pod
+	data := `{"metadata":{"name":"` + name + `","labels":{"app":"` + app + `"},"creationTimestamp":"2026-01-01T00:00:00Z"},` +
+		`"spec":{"containers":[{"name":"php","image":"` + image + `"}]},` +
+		`"status":{"phase":"Running","containerStatuses":[{"name":"php","ready":true,"state":{"running":{}}}]}}`
+	if err := json.Unmarshal([]byte(data), &pod); err != nil {
+		t.Fatal(err)
+	}
+
+	return pod
+}
+
+func TestDiscovery(t *testing.T) {
+	artifactService := docker.NewArtifactService(t.TempDir())
+	if err := artifactService.Register("app", docker.ArtifactConfig{Image: "app", RootDir: "/app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The configured endpoint is not bound to its pod yet
+	epsCfg := map[string]EndpointConfig{
+		"configured": {Artifact: "app", Selector: "app=configured", Container: "php"},
+	}
+
+	cliPool := cli.NewPool("c", "n")
+	pc := NewEndpointsCtrl("", epsCfg, DiscoveryConfig{Enabled: true}, cliPool, artifactService)
+	epCli := cliPool.Get("", "")
+	ctx := context.Background()
+
+	events := make([]EndpointEvent, 0)
+	pc.Subscribe(func(e EndpointEvent) {
+		events = append(events, e)
+	})
+
+	for _, pod := range []cli.Pod{
+		newTestPod(t, "configured-1", "configured", "app:abc"),
+		newTestPod(t, "other-1", "other", "evil.io/team/app:abc"),
+		newTestPod(t, "worker", "worker", "docker.io/library/app:abc"),
+	} {
+		pc.handleDiscoveredPodEvent(ctx, epCli, cli.PodEvent{Type: cli.PodEventAdded, Object: pod})
+	}
+
+	if len(pc.discovered) != 1 {
+		t.Fatalf("discovered %v, want only the worker endpoint", pc.discovered)
+	}
+
+	if ep, ok := pc.endpoints["worker"]; !ok || ep.PodName != "worker" {
+		t.Fatalf("endpoint worker = %+v, want bound to the pod worker", ep)
+	}
+
+	pc.handleDiscoveredPodEvent(ctx, epCli, cli.PodEvent{Type: cli.PodEventDeleted, Object: newTestPod(t, "worker", "worker", "app")})
+
+	if _, ok := pc.discovered["worker"]; ok {
+		t.Error("endpoint worker is still discovered after its last pod is deleted")
+	}
+
+	for _, state := range pc.States() {
+		if state.TagName == "worker" {
+			t.Errorf("endpoint worker still has the state %+v", state)
+		}
+	}
+
+	if n := len(events); n != 2 || !events[1].IsRemoved {
+		t.Errorf("events = %+v, want the worker bound and removed", events)
+	}
+}
@@ -1,11 +1,20 @@
 package k8s
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"skasync/pkg/cli"
 	"skasync/pkg/docker"
+	"sort"
 	"sync"
+	"time"
+)
+
+const (
+	minWatchBackoff = time.Second
+	maxWatchBackoff = time.Second * 10
 )
 
 type EndpointConfig struct {
@@ -14,6 +23,61 @@ type EndpointConfig struct {
 	Container,
 	DockerfileDir,
 	RootDir string
+	// Kube context and namespace of the endpoint, the global ones are used if empty
+	Context,
+	Namespace string
+	// The workload whose pod selector is used instead of Selector, only one can be set
+	Deployment,
+	StatefulSet,
+	DaemonSet,
+	Service string
+	// Containers are synced along with Container, the containers sharing the volume behind
+	// the artifact RootDir are synced once
+	Containers []string
+}
+
+// ContainerNames returns Container and Containers without duplicates
+func (cfg EndpointConfig) ContainerNames() []string {
+	names := make([]string, 0, len(cfg.Containers)+1)
+	seen := make(map[string]struct{})
+
+	for _, name := range append([]string{cfg.Container}, cfg.Containers...) {
+		if _, ok := seen[name]; ok || len(name) == 0 {
+			continue
+		}
+
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Workload returns the kind and the name of the workload the pods are selected by, empty if
+// the raw selector is used
+func (cfg EndpointConfig) Workload() (kind, name string) {
+	switch {
+	case len(cfg.Deployment) > 0:
+		return cli.KindDeployment, cfg.Deployment
+	case len(cfg.StatefulSet) > 0:
+		return cli.KindStatefulSet, cfg.StatefulSet
+	case len(cfg.DaemonSet) > 0:
+		return cli.KindDaemonSet, cfg.DaemonSet
+	case len(cfg.Service) > 0:
+		return cli.KindService, cfg.Service
+	default:
+		return "", ""
+	}
+}
+
+// resolveSelector returns the pod selector of the endpoint, the workload one is read from the cluster
+func (cfg EndpointConfig) resolveSelector(kubeCtl *cli.KubeCtl) (string, error) {
+	kind, name := cfg.Workload()
+	if len(kind) == 0 {
+		return cfg.Selector, nil
+	}
+
+	return kubeCtl.GetWorkloadSelector(kind, name)
 }
 
 func CheckEndpointsCfg(pods map[string]EndpointConfig) error {
@@ -22,11 +86,22 @@ func CheckEndpointsCfg(pods map[string]EndpointConfig) error {
 			return fmt.Errorf("pod require artifact id: %+v", podCfg)
 		}
 
-		if len(podCfg.Selector) == 0 {
-			return errors.New("pod selector not found")
+		sources := 0
+		for _, v := range []string{podCfg.Selector, podCfg.Deployment, podCfg.StatefulSet, podCfg.DaemonSet, podCfg.Service} {
+			if len(v) > 0 {
+				sources++
+			}
 		}
 
-		if len(podCfg.Container) == 0 {
+		if sources == 0 {
+			return errors.New("pod selector or workload not found")
+		}
+
+		if sources > 1 {
+			return fmt.Errorf("pod \"%s\" requires only one of Selector, Deployment, StatefulSet, DaemonSet, Service", podCfg.Artifact)
+		}
+
+		if len(podCfg.ContainerNames()) == 0 {
 			return fmt.Errorf("pod \"%s\" require container name", podCfg.Artifact)
 		}
 	}
@@ -36,99 +111,647 @@ func CheckEndpointsCfg(pods map[string]EndpointConfig) error {
 
 type Endpoint struct {
 	TagName,
+	PodName string
+	// Containers are the containers of the endpoint, SyncContainers are the ones the files are
+	// synced to: of the containers sharing the volume behind the artifact RootDir only the first one
+	Containers,
+	SyncContainers []string
+	Artifact *docker.Artifact
+	// CLI runs kubectl in the context and namespace of the endpoint
+	CLI *cli.CLI
+}
+
+// Location is the "context/namespace/pod" of the endpoint
+func (ep *Endpoint) Location() string {
+	return ep.CLI.String() + "/" + ep.PodName
+}
+
+// EndpointEvent reports the endpoint moved to another pod, PodName is empty when
+// no pod is eligible (see Reason), PrevPodName is empty when the endpoint has appeared.
+// IsRemoved is set when the endpoint is removed from the reloaded config or the discovered one has lost its last pod
+type EndpointEvent struct {
+	TagName,
+	Context,
+	Namespace,
 	PodName,
-	Container string
-	Artifact docker.Artifact
+	PrevPodName,
+	Reason string
+	IsRemoved bool
+}
+
+const (
+	EndpointStateReady   = "Ready"
+	EndpointStateWaiting = "Waiting"
+)
+
+// EndpointState is the last known state of the endpoint, the changes of the waiting
+// endpoint are queued until its pod is ready
+type EndpointState struct {
+	TagName        string   `json:"tag"`
+	Artifact       string   `json:"artifact"`
+	State          string   `json:"state"`
+	Context        string   `json:"context"`
+	Namespace      string   `json:"namespace"`
+	PodName        string   `json:"pod,omitempty"`
+	Containers     []string `json:"containers"`
+	SyncContainers []string `json:"syncContainers,omitempty"`
+	Reason         string   `json:"reason,omitempty"`
+}
+
+func newEndpointState(tagName, artifactId string, epCli *cli.CLI, containers []string, ep *Endpoint, reason string) EndpointState {
+	state := EndpointState{
+		TagName:    tagName,
+		Artifact:   artifactId,
+		State:      EndpointStateWaiting,
+		Context:    epCli.Context(),
+		Namespace:  epCli.Namespace(),
+		Containers: containers,
+		Reason:     reason,
+	}
+
+	if ep != nil {
+		state.State = EndpointStateReady
+		state.PodName = ep.PodName
+		state.SyncContainers = ep.SyncContainers
+	}
+
+	return state
 }
 
 type EndpointCtrl struct {
 	rootDir         string
 	epsCfg          map[string]EndpointConfig
-	kubeCtl         *cli.KubeCtl
+	discoveryCfg    DiscoveryConfig
+	cliPool         *cli.Pool
 	artifactService *docker.ArtifactService
 
 	mu        sync.Mutex
 	endpoints map[string]*Endpoint
+	// pods are the watched pods by the endpoint tag
+	pods map[string]map[string]cli.Pod
+	// selectors are the resolved pod selectors by the endpoint tag, see isConfiguredContainer
+	selectors   map[string]string
+	states      map[string]EndpointState
+	isWatching  bool
+	subscribers []func(EndpointEvent)
+	// discovered are the endpoints found by the image, see DiscoveryConfig
+	discovered map[string]discoveredEndpoint
+	// ctx is the Listen context, watches and cancelDiscovery stop the pod watches of the
+	// endpoints by the tag and the discovery, see Update
+	ctx             context.Context
+	watches         map[string]context.CancelFunc
+	cancelDiscovery context.CancelFunc
 }
 
-func NewEndpointsCtrl(rootDir string, podsCfg map[string]EndpointConfig, kubeCtl *cli.KubeCtl, artifactService *docker.ArtifactService) *EndpointCtrl {
+func NewEndpointsCtrl(rootDir string, podsCfg map[string]EndpointConfig, discoveryCfg DiscoveryConfig, cliPool *cli.Pool, artifactService *docker.ArtifactService) *EndpointCtrl {
 	return &EndpointCtrl{
 		rootDir:         rootDir,
 		epsCfg:          podsCfg,
-		kubeCtl:         kubeCtl,
+		discoveryCfg:    discoveryCfg,
+		discovered:      make(map[string]discoveredEndpoint),
+		cliPool:         cliPool,
 		artifactService: artifactService,
 		endpoints:       make(map[string]*Endpoint),
+		pods:            make(map[string]map[string]cli.Pod),
+		selectors:       make(map[string]string),
+		states:          make(map[string]EndpointState),
+		subscribers:     make([]func(EndpointEvent), 0),
+		watches:         make(map[string]context.CancelFunc),
+	}
+}
+
+func (pc *EndpointCtrl) Subscribe(cb func(EndpointEvent)) {
+	pc.mu.Lock()
+	pc.subscribers = append(pc.subscribers, cb)
+	pc.mu.Unlock()
+}
+
+func (pc *EndpointCtrl) publish(e EndpointEvent) {
+	pc.mu.Lock()
+	subscribers := pc.subscribers
+	pc.mu.Unlock()
+
+	for _, cb := range subscribers {
+		cb(e)
+	}
+}
+
+// Listen watches the pods of every endpoint and moves the endpoints as the pods come and go.
+// The broken watch is restarted
+func (pc *EndpointCtrl) Listen(ctx context.Context) error {
+	pc.mu.Lock()
+	pc.isWatching = true
+	pc.ctx = ctx
+
+	for tagName, epCfg := range pc.epsCfg {
+		pc.startWatch(tagName, epCfg)
+	}
+
+	if pc.discoveryCfg.Enabled {
+		pc.startDiscovery()
+	}
+	pc.mu.Unlock()
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// Update applies the reloaded endpoints config. The watches of the removed and changed endpoints
+// (the ones of the changed artifacts too) are stopped, the added and changed endpoints are watched
+// anew. The discovery starts over if the artifacts or the set of the endpoints have changed
+func (pc *EndpointCtrl) Update(epsCfg map[string]EndpointConfig, changedArtifacts []string) {
+	isChangedArtifact := make(map[string]bool, len(changedArtifacts))
+	for _, id := range changedArtifacts {
+		isChangedArtifact[id] = true
+	}
+
+	pc.mu.Lock()
+
+	events := make([]EndpointEvent, 0)
+	isSetChanged := false
+
+	for tagName, prevCfg := range pc.epsCfg {
+		epCfg, ok := epsCfg[tagName]
+		if ok && reflect.DeepEqual(prevCfg, epCfg) && !isChangedArtifact[prevCfg.Artifact] {
+			continue
+		}
+
+		epCli := pc.cliPool.Get(prevCfg.Context, prevCfg.Namespace)
+		if !ok {
+			event := pc.unbind(tagName, prevCfg.Artifact, epCli, prevCfg.ContainerNames(), "endpoint is removed from config")
+			event.IsRemoved = true
+			delete(pc.states, tagName)
+			isSetChanged = true
+			events = append(events, event)
+			continue
+		}
+
+		events = append(events, pc.unbind(tagName, prevCfg.Artifact, epCli, prevCfg.ContainerNames(), "endpoint config is reloaded"))
+	}
+
+	prevEpsCfg := pc.epsCfg
+	pc.epsCfg = epsCfg
+
+	for tagName, epCfg := range epsCfg {
+		if _, ok := prevEpsCfg[tagName]; !ok {
+			isSetChanged = true
+		} else if _, ok := pc.watches[tagName]; ok {
+			continue
+		}
+
+		if pc.isWatching {
+			pc.startWatch(tagName, epCfg)
+		}
+	}
+
+	if pc.isWatching && pc.discoveryCfg.Enabled && (isSetChanged || len(changedArtifacts) > 0) {
+		pc.cancelDiscovery()
+
+		epCli := pc.cliPool.Get("", "")
+		for tagName, d := range pc.discovered {
+			events = append(events, pc.unbind(tagName, d.Artifact.Id, epCli, []string{d.Container}, "endpoints are discovered anew"))
+		}
+
+		pc.startDiscovery()
+	}
+
+	pc.mu.Unlock()
+
+	for _, event := range events {
+		pc.publish(event)
+	}
+}
+
+// Rewatch restarts the pod watches of every endpoint and the discovery, the endpoints are resolved
+// anew as if the watcher has started. Refresh is used instead without the watch
+func (pc *EndpointCtrl) Rewatch() error {
+	pc.mu.Lock()
+
+	if !pc.isWatching {
+		pc.mu.Unlock()
+		return pc.Refresh()
+	}
+
+	events := make([]EndpointEvent, 0)
+	for tagName, epCfg := range pc.epsCfg {
+		epCli := pc.cliPool.Get(epCfg.Context, epCfg.Namespace)
+		events = append(events, pc.unbind(tagName, epCfg.Artifact, epCli, epCfg.ContainerNames(), "endpoint is refreshed"))
+		pc.startWatch(tagName, epCfg)
+	}
+
+	if pc.discoveryCfg.Enabled {
+		pc.cancelDiscovery()
+
+		epCli := pc.cliPool.Get("", "")
+		for tagName, d := range pc.discovered {
+			events = append(events, pc.unbind(tagName, d.Artifact.Id, epCli, []string{d.Container}, "endpoint is refreshed"))
+		}
+
+		pc.startDiscovery()
+	}
+
+	pc.mu.Unlock()
+
+	for _, event := range events {
+		pc.publish(event)
+	}
+
+	return nil
+}
+
+// unbind stops the pods watch of the endpoint and takes it off the pod for the reason,
+// must be called with the lock held
+func (pc *EndpointCtrl) unbind(tagName, artifactId string, epCli *cli.CLI, containers []string, reason string) EndpointEvent {
+	if cancel, ok := pc.watches[tagName]; ok {
+		cancel()
+		delete(pc.watches, tagName)
+	}
+
+	prevPodName := ""
+	if ep, ok := pc.endpoints[tagName]; ok {
+		prevPodName = ep.PodName
+	}
+
+	delete(pc.endpoints, tagName)
+	delete(pc.pods, tagName)
+	delete(pc.selectors, tagName)
+	pc.states[tagName] = newEndpointState(tagName, artifactId, epCli, containers, nil, reason)
+
+	return EndpointEvent{
+		TagName:     tagName,
+		Context:     epCli.Context(),
+		Namespace:   epCli.Namespace(),
+		PrevPodName: prevPodName,
+		Reason:      reason,
+	}
+}
+
+// startWatch must be called with the lock held
+func (pc *EndpointCtrl) startWatch(tagName string, epCfg EndpointConfig) {
+	ctx, cancel := context.WithCancel(pc.ctx)
+	pc.watches[tagName] = cancel
+
+	go pc.watchEndpoint(ctx, tagName, epCfg)
+}
+
+// startDiscovery must be called with the lock held
+func (pc *EndpointCtrl) startDiscovery() {
+	ctx, cancel := context.WithCancel(pc.ctx)
+	pc.cancelDiscovery = cancel
+
+	go pc.watchDiscovery(ctx)
+}
+
+func (pc *EndpointCtrl) watchEndpoint(ctx context.Context, tagName string, epCfg EndpointConfig) {
+	epCli := pc.cliPool.Get(epCfg.Context, epCfg.Namespace)
+
+	artifact, err := pc.artifactService.FindById(epCfg.Artifact)
+	if err != nil {
+		// The endpoint is not watched until the config is fixed, the state tells why
+		reason := fmt.Sprintf("artifact %s: %s", epCfg.Artifact, err)
+		fmt.Printf("\033[31mEndpoint %s is not watched:\033[0m %s\n", tagName, reason)
+
+		pc.mu.Lock()
+		if ctx.Err() == nil {
+			pc.states[tagName] = newEndpointState(tagName, epCfg.Artifact, epCli, epCfg.ContainerNames(), nil, reason)
+		}
+		pc.mu.Unlock()
+
+		return
+	}
+
+	kubeCtl := cli.NewKubeCtl(epCli)
+	backoff := minWatchBackoff
+	isRestarted := false
+
+	for {
+		pc.mu.Lock()
+		// The stopped watch must not touch the endpoint, it may be watched anew already
+		if ctx.Err() != nil {
+			pc.mu.Unlock()
+			return
+		}
+		pc.pods[tagName] = make(map[string]cli.Pod)
+
+		// The pods are not known until the new watch lists them, the endpoint leaves the pod of the broken watch
+		var event EndpointEvent
+		isChanged := false
+		if isRestarted {
+			event, isChanged = pc.bind(tagName, epCfg.ContainerNames(), artifact, epCli)
+
+			state := pc.states[tagName]
+			state.Reason = "pods watch is restarting"
+			pc.states[tagName] = state
+			event.Reason = state.Reason
+		}
+		pc.mu.Unlock()
+
+		if isChanged {
+			pc.publish(event)
+		}
+
+		startedAt := time.Now()
+
+		// The workload selector is resolved on every watch start, so the changed labels are followed
+		selector, err := epCfg.resolveSelector(kubeCtl)
+		if err == nil {
+			pc.mu.Lock()
+			if ctx.Err() == nil {
+				pc.selectors[tagName] = selector
+			}
+			pc.mu.Unlock()
+
+			err = kubeCtl.WatchPods(ctx, selector, func(e cli.PodEvent) {
+				pc.handlePodEvent(ctx, tagName, epCfg, artifact, epCli, e)
+			})
+		} else {
+			pc.mu.Lock()
+			if ctx.Err() == nil {
+				pc.states[tagName] = newEndpointState(tagName, epCfg.Artifact, epCli, epCfg.ContainerNames(), nil, err.Error())
+			}
+			pc.mu.Unlock()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(startedAt) > maxWatchBackoff {
+			backoff = minWatchBackoff
+		}
+
+		fmt.Printf("Pods watch of %s (%s) is broken, restarting in %s: %s\n", tagName, epCli, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+
+		isRestarted = true
 	}
 }
 
-func (pc *EndpointCtrl) register(tagName string, epCfg EndpointConfig) error {
-	podName, err := pc.kubeCtl.GetPodName(epCfg.Selector)
+func (pc *EndpointCtrl) handlePodEvent(ctx context.Context, tagName string, epCfg EndpointConfig, artifact *docker.Artifact, epCli *cli.CLI, e cli.PodEvent) {
+	pc.mu.Lock()
+
+	if ctx.Err() != nil {
+		pc.mu.Unlock()
+		return
+	}
+
+	pods := pc.pods[tagName]
+	if e.Type == cli.PodEventDeleted {
+		delete(pods, e.Object.Metadata.Name)
+	} else {
+		pods[e.Object.Metadata.Name] = e.Object
+	}
+
+	event, isChanged := pc.bind(tagName, epCfg.ContainerNames(), artifact, epCli)
+
+	pc.mu.Unlock()
+
+	if isChanged {
+		pc.publish(event)
+	}
+}
+
+// bind moves the endpoint to the selected pod of its watched pods, must be called with the lock held
+func (pc *EndpointCtrl) bind(tagName string, containers []string, artifact *docker.Artifact, epCli *cli.CLI) (EndpointEvent, bool) {
+	prevPodName := ""
+	if ep, ok := pc.endpoints[tagName]; ok {
+		prevPodName = ep.PodName
+	}
+
+	podName, reason := selectPod(pc.pods[tagName], prevPodName, containers)
+	prevState := pc.states[tagName]
+
+	var ep *Endpoint
+	if len(podName) > 0 {
+		ep = newEndpoint(tagName, pc.pods[tagName][podName], containers, artifact, epCli)
+	}
+
+	pc.states[tagName] = newEndpointState(tagName, artifact.Id, epCli, containers, ep, reason)
+	if podName == prevPodName && reason == prevState.Reason {
+		return EndpointEvent{}, false
+	}
+
+	if ep == nil {
+		delete(pc.endpoints, tagName)
+	} else {
+		pc.endpoints[tagName] = ep
+	}
+
+	return EndpointEvent{
+		TagName:     tagName,
+		Context:     epCli.Context(),
+		Namespace:   epCli.Namespace(),
+		PodName:     podName,
+		PrevPodName: prevPodName,
+		Reason:      reason,
+	}, true
+}
+
+func newEndpoint(tagName string, pod cli.Pod, containers []string, artifact *docker.Artifact, epCli *cli.CLI) *Endpoint {
+	return &Endpoint{
+		TagName:        tagName,
+		PodName:        pod.Metadata.Name,
+		Containers:     containers,
+		SyncContainers: syncContainers(pod, containers, artifact.RootDir),
+		Artifact:       artifact,
+		CLI:            epCli,
+	}
+}
+
+// syncContainers drops the containers that see the files of RootDir through the volume location
+// of a previous container. Without RootDir the mappings may point anywhere, every container is synced
+func syncContainers(pod cli.Pod, containers []string, rootDir string) []string {
+	if len(rootDir) == 0 {
+		return containers
+	}
+
+	result := make([]string, 0, len(containers))
+	locations := make(map[string]struct{})
+
+	for _, container := range containers {
+		location, ok := pod.VolumePath(container, rootDir)
+		if ok {
+			if _, isShared := locations[location]; isShared {
+				continue
+			}
+
+			locations[location] = struct{}{}
+		}
+
+		result = append(result, container)
+	}
+
+	return result
+}
+
+// unavailableReason returns the reason of the first container of the pod that can't be synced
+func unavailableReason(pod cli.Pod, containers []string) string {
+	for _, container := range containers {
+		if reason := pod.ContainerUnavailableReason(container); len(reason) > 0 {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+// selectPod keeps the current pod while its containers are ready, otherwise the newest pod with
+// all containers ready is taken. If there is none, the reason is the state of the newest pod
+func selectPod(pods map[string]cli.Pod, current string, containers []string) (podName, reason string) {
+	if pod, ok := pods[current]; ok && len(unavailableReason(pod, containers)) == 0 {
+		return current, ""
+	}
+
+	if len(pods) == 0 {
+		return "", "no pods match the selector"
+	}
+
+	list := make([]cli.Pod, 0, len(pods))
+	for _, pod := range pods {
+		list = append(list, pod)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		// RFC 3339 timestamps of the same zone are ordered as strings
+		return list[i].Metadata.CreationTimestamp > list[j].Metadata.CreationTimestamp
+	})
+
+	for _, pod := range list {
+		if len(unavailableReason(pod, containers)) == 0 {
+			return pod.Metadata.Name, ""
+		}
+	}
+
+	return "", unavailableReason(list[0], containers)
+}
+
+// register resolves the pod of the endpoint once, the endpoint not resolved keeps the reason in its state
+func (pc *EndpointCtrl) register(tagName string, epCfg EndpointConfig) (err error) {
+	epCli := pc.cliPool.Get(epCfg.Context, epCfg.Namespace)
+	containers := epCfg.ContainerNames()
+
+	defer func() {
+		if err != nil {
+			pc.mu.Lock()
+			pc.states[tagName] = newEndpointState(tagName, epCfg.Artifact, epCli, containers, nil, err.Error())
+			pc.mu.Unlock()
+		}
+	}()
+
+	kubeCtl := cli.NewKubeCtl(epCli)
+
+	selector, err := epCfg.resolveSelector(kubeCtl)
 	if err != nil {
 		return err
 	}
 
-	artifact, err := pc.artifactService.FindById(epCfg.Artifact)
+	pc.mu.Lock()
+	pc.selectors[tagName] = selector
+	pc.mu.Unlock()
+
+	pods, err := kubeCtl.GetPods(selector)
 	if err != nil {
 		return err
 	}
 
-	if pc.HasEndpointExist(podName) {
-		return fmt.Errorf("endpoint \"%s\" already exist", podName)
+	podsMap := make(map[string]cli.Pod, len(pods))
+	for _, pod := range pods {
+		podsMap[pod.Metadata.Name] = pod
 	}
 
-	newEndpoint := &Endpoint{
-		TagName:   tagName,
-		PodName:   podName,
-		Container: epCfg.Container,
-		Artifact:  artifact,
+	podName, reason := selectPod(podsMap, "", containers)
+	if len(podName) == 0 {
+		return fmt.Errorf("selector \"%s\": %s", selector, reason)
 	}
 
+	artifact, err := pc.artifactService.FindById(epCfg.Artifact)
+	if err != nil {
+		return err
+	}
+
+	ep := newEndpoint(tagName, podsMap[podName], containers, artifact, epCli)
+
 	pc.mu.Lock()
 	defer pc.mu.Unlock()
 
-	pc.endpoints[tagName] = newEndpoint
+	// The endpoints are registered concurrently, the pod is checked and taken at once
+	if pc.hasEndpointExist(epCli, podName) {
+		return fmt.Errorf("pod \"%s\" is already taken by another endpoint in %s", podName, epCli)
+	}
+
+	pc.states[tagName] = newEndpointState(tagName, artifact.Id, epCli, containers, ep, "")
+	pc.endpoints[tagName] = ep
 
 	return nil
 }
 
-func (pc *EndpointCtrl) HasEndpointExist(name string) bool {
+func (pc *EndpointCtrl) HasEndpointExist(epCli *cli.CLI, name string) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	return pc.hasEndpointExist(epCli, name)
+}
+
+// hasEndpointExist must be called with the lock held
+func (pc *EndpointCtrl) hasEndpointExist(epCli *cli.CLI, name string) bool {
 	for _, p := range pc.endpoints {
-		if p.PodName == name {
+		if p.PodName == name && p.CLI == epCli {
 			return true
 		}
 	}
 	return false
 }
 
+// Refresh resolves the endpoints once, while the pods are watched the endpoints are kept up to date.
+// The endpoint without a pod doesn't fail the refresh, States tells why it isn't resolved
 func (pc *EndpointCtrl) Refresh() error {
 	pc.mu.Lock()
+	if pc.isWatching {
+		pc.mu.Unlock()
+		return nil
+	}
+
 	pc.endpoints = make(map[string]*Endpoint)
 	pc.mu.Unlock()
 
 	wg := sync.WaitGroup{}
 
-	var errs []error = make([]error, 0)
-
 	for tagName, epCfg := range pc.epsCfg {
 		wg.Add(1)
 		go func(tagName string, epCfg EndpointConfig) {
+			defer wg.Done()
+
 			if err := pc.register(tagName, epCfg); err != nil {
-				errs = append(errs, err)
+				fmt.Printf("\033[33mEndpoint %s is not resolved:\033[0m %s\n", tagName, err)
 			}
-			wg.Done()
 		}(tagName, epCfg)
 	}
 
 	wg.Wait()
 
-	if len(errs) > 0 {
-		return fmt.Errorf("%+v", errs)
+	if pc.discoveryCfg.Enabled {
+		if err := pc.discover(); err != nil {
+			return fmt.Errorf("endpoints discovery: %w", err)
+		}
 	}
 
 	return nil
 }
 
 func (pc *EndpointCtrl) GetPods() []*Endpoint {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
 	pods := make([]*Endpoint, 0, len(pc.endpoints))
 
 	for key := range pc.endpoints {
@@ -148,7 +771,91 @@ func (pc *EndpointCtrl) GetPods() []*Endpoint {
 // 	return nil, errors.New("endpoint not found")
 // }
 
+// States returns the states of the endpoints sorted by tag, the endpoints not resolved yet are waiting
+func (pc *EndpointCtrl) States() []EndpointState {
+	tags := pc.Tags()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	states := make([]EndpointState, 0, len(tags))
+	for _, tagName := range tags {
+		state, ok := pc.states[tagName]
+		if !ok {
+			state = EndpointState{
+				TagName:  tagName,
+				Artifact: pc.epsCfg[tagName].Artifact,
+				State:    EndpointStateWaiting,
+				Reason:   "pods are not resolved yet",
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	return states
+}
+
+// Pods returns the watched pods of the endpoint sorted by name, the bound one is among them
+func (pc *EndpointCtrl) Pods(tagName string) []cli.Pod {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pods := make([]cli.Pod, 0, len(pc.pods[tagName]))
+	for _, pod := range pc.pods[tagName] {
+		pods = append(pods, pod)
+	}
+
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Metadata.Name < pods[j].Metadata.Name
+	})
+
+	return pods
+}
+
+// Tags returns the tags of all configured and discovered endpoints, including the ones without a pod
+func (pc *EndpointCtrl) Tags() []string {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	tags := make([]string, 0, len(pc.epsCfg)+len(pc.discovered))
+	for tagName := range pc.epsCfg {
+		tags = append(tags, tagName)
+	}
+
+	for tagName := range pc.discovered {
+		tags = append(tags, tagName)
+	}
+
+	sort.Strings(tags)
+
+	return tags
+}
+
+// Artifacts returns the artifacts of the configured and discovered endpoints by the tag, the endpoints
+// of the unknown artifacts are skipped
+func (pc *EndpointCtrl) Artifacts() map[string]*docker.Artifact {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	artifacts := make(map[string]*docker.Artifact, len(pc.epsCfg)+len(pc.discovered))
+	for tagName, epCfg := range pc.epsCfg {
+		if artifact, err := pc.artifactService.FindById(epCfg.Artifact); err == nil {
+			artifacts[tagName] = artifact
+		}
+	}
+
+	for tagName, ep := range pc.discovered {
+		artifacts[tagName] = ep.Artifact
+	}
+
+	return artifacts
+}
+
 func (pc *EndpointCtrl) FindByTag(tagName string) (*Endpoint, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
 	for _, pod := range pc.endpoints {
 		if pod.TagName == tagName {
 			return pod, nil
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"skasync/pkg/cli"
+	"skasync/pkg/docker"
+	"strings"
+	"testing"
+)
+
+// fakeKubectl lists a running pod for the selectors app=<name>, the other selectors have no pods
+const fakeKubectl = `#!/bin/sh
+for arg in "$@"; do selector="$arg"; done
+case "$selector" in
+  app=none) echo '{"items":[]}' ;;
+  app=*) name="${selector#app=}"; echo '{"items":[{"metadata":{"name":"'$name'-1","creationTimestamp":"2026-01-01T00:00:00Z"},"status":{"phase":"Running","containerStatuses":[{"name":"php","ready":true,"state":{"running":{}}}]}}]}' ;;
+esac
+`
+
+func withFakeKubectl(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(fakeKubectl), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRefreshSkipsEndpointsWithoutPod(t *testing.T) {
+	withFakeKubectl(t)
+
+	artifactService := docker.NewArtifactService(t.TempDir())
+	if err := artifactService.Register("app", docker.ArtifactConfig{Image: "app", RootDir: "/app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	epsCfg := map[string]EndpointConfig{
+		"none": {Artifact: "app", Selector: "app=none", Container: "php"},
+		// Both endpoints select the same pod, only one of them takes it
+		"shared-1": {Artifact: "app", Selector: "app=shared", Container: "php"},
+		"shared-2": {Artifact: "app", Selector: "app=shared", Container: "php"},
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		epsCfg[name] = EndpointConfig{Artifact: "app", Selector: "app=" + name, Container: "php"}
+	}
+
+	pc := NewEndpointsCtrl("", epsCfg, DiscoveryConfig{}, cli.NewPool("c", "n"), artifactService)
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	if n := len(pc.GetPods()); n != 5 {
+		t.Errorf("GetPods() returned %d endpoints, want 5", n)
+	}
+
+	taken := 0
+	for _, state := range pc.States() {
+		switch {
+		case state.TagName == "none":
+			if len(state.PodName) > 0 || !strings.Contains(state.Reason, "app=none") {
+				t.Errorf("state of none = %+v, want the reason without a pod", state)
+			}
+		case strings.HasPrefix(state.TagName, "shared-") && len(state.PodName) == 0:
+			if !strings.Contains(state.Reason, "already taken") {
+				t.Errorf("state of %s = %+v, want the taken pod reason", state.TagName, state)
+			}
+		case len(state.PodName) == 0:
+			t.Errorf("endpoint %s has no pod: %s", state.TagName, state.Reason)
+		default:
+			taken++
+		}
+	}
+
+	if taken != 5 {
+		t.Errorf("%d endpoints have a pod, want 5", taken)
+	}
+}
@@ -0,0 +1,85 @@
+package k8s
+
+import "strings"
+
+// matchesSelector reports whether the labels match the kubectl label selector: the comma-separated
+// requirements "key", "!key", "key=value", "key==value", "key!=value", "key in (a,b)" and "key notin (a,b)"
+func matchesSelector(selector string, labels map[string]string) bool {
+	for _, requirement := range splitSelector(selector) {
+		if !matchesRequirement(requirement, labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitSelector splits the selector by the commas outside of the value sets
+func splitSelector(selector string) []string {
+	requirements := make([]string, 0)
+	depth, start := 0, 0
+
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				requirements = append(requirements, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	requirements = append(requirements, selector[start:])
+
+	result := make([]string, 0, len(requirements))
+	for _, requirement := range requirements {
+		if requirement = strings.TrimSpace(requirement); len(requirement) > 0 {
+			result = append(result, requirement)
+		}
+	}
+
+	return result
+}
+
+func matchesRequirement(requirement string, labels map[string]string) bool {
+	if fields := strings.Fields(requirement); len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin") {
+		set := strings.TrimSpace(strings.Join(fields[2:], " "))
+		set = strings.TrimSuffix(strings.TrimPrefix(set, "("), ")")
+
+		value, ok := labels[fields[0]]
+		isIn := false
+		for _, v := range strings.Split(set, ",") {
+			if ok && strings.TrimSpace(v) == value {
+				isIn = true
+				break
+			}
+		}
+
+		if fields[1] == "in" {
+			return isIn
+		}
+
+		return !isIn
+	}
+
+	if i := strings.Index(requirement, "!="); i >= 0 {
+		value, ok := labels[strings.TrimSpace(requirement[:i])]
+		return !ok || value != strings.TrimSpace(requirement[i+2:])
+	}
+
+	if i := strings.Index(requirement, "="); i >= 0 {
+		value, ok := labels[strings.TrimSpace(requirement[:i])]
+		return ok && value == strings.TrimSpace(strings.TrimPrefix(requirement[i+1:], "="))
+	}
+
+	if strings.HasPrefix(requirement, "!") {
+		_, ok := labels[strings.TrimSpace(requirement[1:])]
+		return !ok
+	}
+
+	_, ok := labels[requirement]
+	return ok
+}
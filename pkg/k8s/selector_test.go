@@ -0,0 +1,35 @@
+package k8s
+
+import "testing"
+
+func TestMatchesSelector(t *testing.T) {
+	labels := map[string]string{"app": "php", "tier": "backend"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"app=php", true},
+		{"app==php", true},
+		{"app=php,tier=backend", true},
+		{"app=php,tier=frontend", false},
+		{"app!=php", false},
+		{"env!=prod", true},
+		{"tier", true},
+		{"env", false},
+		{"!env", true},
+		{"!app", false},
+		{"tier in (frontend, backend)", true},
+		{"tier in (frontend)", false},
+		{"tier notin (frontend,backend)", false},
+		{"env notin (prod)", true},
+		{"app=php,tier in (backend,frontend),!env", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchesSelector(tt.selector, labels); got != tt.want {
+			t.Errorf("matchesSelector(%q) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
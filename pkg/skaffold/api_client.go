@@ -0,0 +1,86 @@
+package skaffold
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+const (
+	APIVersionAuto = "auto"
+	APIVersionV1   = "v1"
+	APIVersionV2   = "v2"
+)
+
+var (
+	ErrAPIVersionNotSupported = errors.New("skaffold API version is not supported")
+)
+
+// APIClient is a transport to the skaffold control API of the certain version
+type APIClient interface {
+	// Version negotiates the API version with skaffold, if needed, and returns it
+	Version(ctx context.Context) (string, error)
+	GetState(ctx context.Context) (State, error)
+	Events(ctx context.Context) (EventStream, error)
+	// Execute asks skaffold to run the dev loop phases, used when auto-build is off
+	// or when the change is made outside of the skaffold watcher
+	Execute(ctx context.Context, intent Intent) error
+}
+
+type Intent struct {
+	Build  bool `json:"build"`
+	Sync   bool `json:"sync"`
+	Deploy bool `json:"deploy"`
+}
+
+type EventStream interface {
+	// Next blocks until the next event
+	Next() (LogEntry, error)
+	Close() error
+}
+
+func NewAPIClient(cfg Config) (APIClient, error) {
+	if err := CheckConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.GRPCAddr) > 0 {
+		return NewGRPCClient(cfg.GRPCAddr)
+	}
+
+	return NewHTTPClient(cfg.Addr, strings.ToLower(cfg.APIVersion)), nil
+}
+
+// normalizeStatus converts the status of v1 and v2 APIs to the v1 form
+func normalizeStatus(status string) string {
+	switch status {
+	case "InProgress", "In Progress":
+		return StatusInProgress
+	case "Succeeded", "Complete", "Completed":
+		return StatusComplete
+	default:
+		return status
+	}
+}
+
+func normalizeStatusCheckStatus(status string) string {
+	switch status {
+	case "InProgress", "In Progress", "Started":
+		return StatusCheckStarted
+	case "Succeeded", "Complete", "Completed":
+		return StatusCheckSucceeded
+	default:
+		return status
+	}
+}
+
+func normalizeState(state State) State {
+	for image, status := range state.BuildState.Artifacts {
+		state.BuildState.Artifacts[image] = normalizeStatus(status)
+	}
+
+	state.DeployState.Status = normalizeStatus(state.DeployState.Status)
+	state.StatusCheckState.Status = normalizeStatusCheckStatus(state.StatusCheckState.Status)
+
+	return state
+}
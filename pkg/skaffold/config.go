@@ -1,13 +1,47 @@
 package skaffold
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Config struct {
-	Addr                 string
+	// Address of the skaffold HTTP API (--rpc-http-port)
+	Addr string
+	// Address of the skaffold gRPC API (--rpc-port), used instead of Addr when set. It serves v1 only
+	GRPCAddr string
+	// auto, v1 or v2, auto is v1 with GRPCAddr
+	APIVersion           string
 	WatchingDeployStatus bool
+	// Path to skaffold.yaml to load artifacts and endpoints from, relative to RootDir
+	ConfigFile string
+	Profiles   []string
 }
 
 func DefaultConfig() Config {
 	return Config{
 		Addr:                 "127.0.0.1:50052",
+		GRPCAddr:             "",
+		APIVersion:           APIVersionAuto,
 		WatchingDeployStatus: false,
+		ConfigFile:           "",
+		Profiles:             []string{},
+	}
+}
+
+// CheckConfig returns the error for the unknown API version and for v2 requested over gRPC
+func CheckConfig(cfg Config) error {
+	version := strings.ToLower(cfg.APIVersion)
+
+	switch version {
+	case "", APIVersionAuto, APIVersionV1, APIVersionV2:
+	default:
+		return fmt.Errorf("%w: %s", ErrAPIVersionNotSupported, cfg.APIVersion)
+	}
+
+	if len(cfg.GRPCAddr) > 0 && version == APIVersionV2 {
+		return fmt.Errorf("%w: v2 over gRPC, unset Skaffold.GRPCAddr to use v2 over HTTP", ErrAPIVersionNotSupported)
 	}
+
+	return nil
 }
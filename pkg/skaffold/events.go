@@ -0,0 +1,90 @@
+package skaffold
+
+const (
+	StatusInProgress = "In Progress"
+	StatusComplete   = "Complete"
+	StatusFailed     = "Failed"
+
+	StatusCheckStarted   = "Started"
+	StatusCheckSucceeded = "Succeeded"
+	StatusCheckFailed    = "Failed"
+)
+
+// LogEntry is an item of the skaffold event stream, events of every API version are converted to it
+type LogEntry struct {
+	Timestamp string `json:"timestamp"`
+	Entry     string `json:"entry"`
+	Event     Event  `json:"event"`
+}
+
+type Event struct {
+	BuildEvent       *BuildEvent       `json:"buildEvent,omitempty"`
+	DeployEvent      *DeployEvent      `json:"deployEvent,omitempty"`
+	StatusCheckEvent *StatusCheckEvent `json:"statusCheckEvent,omitempty"`
+	DevLoopEvent     *DevLoopEvent     `json:"devLoopEvent,omitempty"`
+	TerminationEvent *TerminationEvent `json:"terminationEvent,omitempty"`
+}
+
+type BuildEvent struct {
+	Artifact string `json:"artifact"`
+	Status   string `json:"status"`
+	Err      string `json:"err"`
+}
+
+type DeployEvent struct {
+	Status string `json:"status"`
+	Err    string `json:"err"`
+}
+
+type StatusCheckEvent struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Err     string `json:"err"`
+}
+
+type DevLoopEvent struct {
+	Iteration int    `json:"iteration"`
+	Status    string `json:"status"`
+}
+
+type TerminationEvent struct {
+	Status string `json:"status"`
+	Err    string `json:"err"`
+}
+
+// State is the skaffold state, the state of every API version is converted to it
+type State struct {
+	BuildState struct {
+		Artifacts map[string]string `json:"artifacts"`
+	} `json:"buildState"`
+	DeployState struct {
+		Status string `json:"status"`
+	} `json:"deployState"`
+	StatusCheckState struct {
+		Status string `json:"status"`
+	} `json:"statusCheckState"`
+}
+
+// Apply updates the state by the event, returns false if the event doesn't change it
+func (s *State) Apply(e Event) bool {
+	switch {
+	case e.BuildEvent != nil:
+		if len(e.BuildEvent.Artifact) == 0 {
+			return false
+		}
+
+		if s.BuildState.Artifacts == nil {
+			s.BuildState.Artifacts = make(map[string]string)
+		}
+
+		s.BuildState.Artifacts[e.BuildEvent.Artifact] = e.BuildEvent.Status
+	case e.DeployEvent != nil:
+		s.DeployState.Status = e.DeployEvent.Status
+	case e.StatusCheckEvent != nil:
+		s.StatusCheckState.Status = e.StatusCheckEvent.Status
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package skaffold
+
+const (
+	TaskBuild       = "Build"
+	TaskDeploy      = "Deploy"
+	TaskStatusCheck = "StatusCheck"
+)
+
+// EventV2 is an item of the v2 event stream (/v2/events)
+type EventV2 struct {
+	Timestamp         string `json:"timestamp"`
+	BuildSubtaskEvent *struct {
+		Artifact string `json:"artifact"`
+		Step     string `json:"step"`
+		Status   string `json:"status"`
+	} `json:"buildSubtaskEvent,omitempty"`
+	DeploySubtaskEvent *struct {
+		Status string `json:"status"`
+	} `json:"deploySubtaskEvent,omitempty"`
+	StatusCheckSubtaskEvent *struct {
+		Resource string `json:"resource"`
+		Status   string `json:"status"`
+		Message  string `json:"message"`
+	} `json:"statusCheckSubtaskEvent,omitempty"`
+	TaskEvent *struct {
+		Task      string `json:"task"`
+		Iteration int    `json:"iteration"`
+		Status    string `json:"status"`
+	} `json:"taskEvent,omitempty"`
+	TerminationEvent *struct {
+		Status string `json:"status"`
+	} `json:"terminationEvent,omitempty"`
+}
+
+// LogEntry converts the event to the v1 model, false if the event doesn't matter
+func (e EventV2) LogEntry() (LogEntry, bool) {
+	entry := LogEntry{Timestamp: e.Timestamp}
+
+	switch {
+	case e.BuildSubtaskEvent != nil:
+		// Cache and push steps don't affect the artifact readiness
+		if len(e.BuildSubtaskEvent.Step) > 0 && e.BuildSubtaskEvent.Step != TaskBuild {
+			return entry, false
+		}
+
+		entry.Event.BuildEvent = &BuildEvent{
+			Artifact: e.BuildSubtaskEvent.Artifact,
+			Status:   normalizeStatus(e.BuildSubtaskEvent.Status),
+		}
+	case e.DeploySubtaskEvent != nil:
+		entry.Event.DeployEvent = &DeployEvent{
+			Status: normalizeStatus(e.DeploySubtaskEvent.Status),
+		}
+	case e.TaskEvent != nil:
+		switch e.TaskEvent.Task {
+		case TaskDeploy:
+			entry.Event.DeployEvent = &DeployEvent{
+				Status: normalizeStatus(e.TaskEvent.Status),
+			}
+		case TaskStatusCheck:
+			entry.Event.StatusCheckEvent = &StatusCheckEvent{
+				Status: normalizeStatusCheckStatus(e.TaskEvent.Status),
+			}
+		default:
+			return entry, false
+		}
+	case e.TerminationEvent != nil:
+		entry.Event.TerminationEvent = &TerminationEvent{
+			Status: e.TerminationEvent.Status,
+		}
+	default:
+		return entry, false
+	}
+
+	return entry, true
+}
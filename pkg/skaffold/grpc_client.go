@@ -0,0 +1,304 @@
+package skaffold
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	grpcGetStateMethod = "/proto.SkaffoldService/GetState"
+	grpcEventsMethod   = "/proto.SkaffoldService/Events"
+	grpcExecuteMethod  = "/proto.SkaffoldService/Execute"
+)
+
+var (
+	errBadProtoMessage = errors.New("skaffold gRPC: malformed message")
+)
+
+// GRPCClient talks to the skaffold v1 gRPC service (--rpc-port). The messages are decoded
+// from the wire format, so only the fields skasync needs are described here
+type GRPCClient struct {
+	conn *grpc.ClientConn
+}
+
+func NewGRPCClient(addr string) (*GRPCClient, error) {
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCClient{conn}, nil
+}
+
+func (c *GRPCClient) Version(ctx context.Context) (string, error) {
+	return APIVersionV1, nil
+}
+
+func (c *GRPCClient) GetState(ctx context.Context) (State, error) {
+	out := []byte{}
+	if err := c.conn.Invoke(ctx, grpcGetStateMethod, []byte{}, &out); err != nil {
+		return State{}, err
+	}
+
+	state, err := decodeStateV1(out)
+	if err != nil {
+		return state, err
+	}
+
+	return normalizeState(state), nil
+}
+
+func (c *GRPCClient) Events(ctx context.Context) (EventStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, grpcEventsMethod)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err := stream.SendMsg([]byte{}); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &grpcEventStream{stream, cancel}, nil
+}
+
+// UserIntentRequest { Intent intent = 1; }
+// Intent { bool build = 1; bool sync = 2; bool deploy = 3; }
+func (c *GRPCClient) Execute(ctx context.Context, intent Intent) error {
+	in := []byte{}
+	for num, value := range map[protowire.Number]bool{1: intent.Build, 2: intent.Sync, 3: intent.Deploy} {
+		if !value {
+			continue
+		}
+
+		in = protowire.AppendTag(in, num, protowire.VarintType)
+		in = protowire.AppendVarint(in, protowire.EncodeBool(value))
+	}
+
+	req := protowire.AppendTag([]byte{}, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, in)
+
+	out := []byte{}
+	return c.conn.Invoke(ctx, grpcExecuteMethod, req, &out)
+}
+
+type grpcEventStream struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+func (es *grpcEventStream) Next() (LogEntry, error) {
+	out := []byte{}
+	if err := es.stream.RecvMsg(&out); err != nil {
+		return LogEntry{}, err
+	}
+
+	entry, err := decodeLogEntryV1(out)
+	if err != nil {
+		return entry, err
+	}
+
+	return normalizeLogEntry(entry), nil
+}
+
+func (es *grpcEventStream) Close() error {
+	es.cancel()
+	return nil
+}
+
+// rawCodec passes the protobuf bytes through, the messages are decoded by hand
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec: unexpected type %T", v)
+	}
+
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec: unexpected type %T", v)
+	}
+
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// walkMessage calls fn for every field of the message, nested messages and strings are passed as bytes
+func walkMessage(b []byte, fn func(num protowire.Number, varint uint64, bytes []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errBadProtoMessage
+		}
+		b = b[n:]
+
+		var varint uint64
+		var bytes []byte
+
+		switch typ {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+
+		if n < 0 {
+			return errBadProtoMessage
+		}
+		b = b[n:]
+
+		if err := fn(num, varint, bytes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeStringField returns the string field of the message with the given number
+func decodeStringField(b []byte, field protowire.Number) (string, error) {
+	value := ""
+	err := walkMessage(b, func(num protowire.Number, _ uint64, bytes []byte) error {
+		if num == field {
+			value = string(bytes)
+		}
+		return nil
+	})
+
+	return value, err
+}
+
+// State { BuildState buildState = 1; DeployState deployState = 2; StatusCheckState statusCheckState = 4; }
+// BuildState { map<string, string> artifacts = 1; }
+// DeployState { string status = 1; }
+// StatusCheckState { string status = 1; }
+func decodeStateV1(b []byte) (State, error) {
+	state := State{}
+	state.BuildState.Artifacts = make(map[string]string)
+
+	err := walkMessage(b, func(num protowire.Number, _ uint64, bytes []byte) error {
+		var err error
+
+		switch num {
+		case 1:
+			err = walkMessage(bytes, func(num protowire.Number, _ uint64, entry []byte) error {
+				if num != 1 {
+					return nil
+				}
+
+				key, err := decodeStringField(entry, 1)
+				if err != nil {
+					return err
+				}
+
+				value, err := decodeStringField(entry, 2)
+				if err != nil {
+					return err
+				}
+
+				state.BuildState.Artifacts[key] = value
+				return nil
+			})
+		case 2:
+			state.DeployState.Status, err = decodeStringField(bytes, 1)
+		case 4:
+			state.StatusCheckState.Status, err = decodeStringField(bytes, 1)
+		}
+
+		return err
+	})
+
+	return state, err
+}
+
+// LogEntry { google.protobuf.Timestamp timestamp = 1; Event event = 2; string entry = 3; }
+// Event { BuildEvent buildEvent = 2; DeployEvent deployEvent = 3; StatusCheckEvent statusCheckEvent = 5; TerminationEvent terminationEvent = 10; }
+// BuildEvent { string artifact = 1; string status = 2; string err = 3; }
+// DeployEvent, TerminationEvent { string status = 1; string err = 2; }
+// StatusCheckEvent { string status = 1; string message = 2; string err = 3; }
+func decodeLogEntryV1(b []byte) (LogEntry, error) {
+	entry := LogEntry{}
+
+	err := walkMessage(b, func(num protowire.Number, _ uint64, bytes []byte) error {
+		switch num {
+		case 1:
+			var seconds, nanos uint64
+			err := walkMessage(bytes, func(num protowire.Number, varint uint64, _ []byte) error {
+				switch num {
+				case 1:
+					seconds = varint
+				case 2:
+					nanos = varint
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			entry.Timestamp = time.Unix(int64(seconds), int64(nanos)).Format(time.RFC3339Nano)
+		case 2:
+			return walkMessage(bytes, func(num protowire.Number, _ uint64, event []byte) error {
+				return decodeEventV1(&entry.Event, num, event)
+			})
+		case 3:
+			entry.Entry = string(bytes)
+		}
+
+		return nil
+	})
+
+	return entry, err
+}
+
+func decodeEventV1(e *Event, num protowire.Number, b []byte) error {
+	fields := make(map[protowire.Number]string)
+	err := walkMessage(b, func(num protowire.Number, _ uint64, bytes []byte) error {
+		fields[num] = string(bytes)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch num {
+	case 2:
+		e.BuildEvent = &BuildEvent{Artifact: fields[1], Status: fields[2], Err: fields[3]}
+	case 3:
+		e.DeployEvent = &DeployEvent{Status: fields[1], Err: fields[2]}
+	case 5:
+		e.StatusCheckEvent = &StatusCheckEvent{Status: fields[1], Message: fields[2], Err: fields[3]}
+	case 10:
+		e.TerminationEvent = &TerminationEvent{Status: fields[1], Err: fields[2]}
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package skaffold
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendVarint(b []byte, num protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+// encodeStateV1 is the skaffold side of decodeStateV1
+func encodeStateV1(state State) []byte {
+	buildState := []byte{}
+	for image, status := range state.BuildState.Artifacts {
+		entry := appendString(appendString(nil, 1, image), 2, status)
+		buildState = appendMessage(buildState, 1, entry)
+	}
+
+	b := appendMessage(nil, 1, buildState)
+	b = appendMessage(b, 2, appendString(nil, 1, state.DeployState.Status))
+	// The fields skasync doesn't know are skipped
+	b = appendVarint(b, 3, 42)
+	b = appendMessage(b, 4, appendString(nil, 1, state.StatusCheckState.Status))
+
+	return b
+}
+
+// encodeLogEntryV1 is the skaffold side of decodeLogEntryV1
+func encodeLogEntryV1(t time.Time, entry LogEntry) []byte {
+	timestamp := appendVarint(appendVarint(nil, 1, uint64(t.Unix())), 2, uint64(t.Nanosecond()))
+
+	event := []byte{}
+	switch e := entry.Event; {
+	case e.BuildEvent != nil:
+		event = appendMessage(event, 2, appendString(appendString(appendString(nil, 1, e.BuildEvent.Artifact), 2, e.BuildEvent.Status), 3, e.BuildEvent.Err))
+	case e.DeployEvent != nil:
+		event = appendMessage(event, 3, appendString(appendString(nil, 1, e.DeployEvent.Status), 2, e.DeployEvent.Err))
+	case e.StatusCheckEvent != nil:
+		event = appendMessage(event, 5, appendString(appendString(appendString(nil, 1, e.StatusCheckEvent.Status), 2, e.StatusCheckEvent.Message), 3, e.StatusCheckEvent.Err))
+	case e.TerminationEvent != nil:
+		event = appendMessage(event, 10, appendString(appendString(nil, 1, e.TerminationEvent.Status), 2, e.TerminationEvent.Err))
+	}
+
+	b := appendMessage(nil, 1, timestamp)
+	b = appendMessage(b, 2, event)
+	b = appendString(b, 3, entry.Entry)
+
+	return b
+}
+
+func TestDecodeStateV1(t *testing.T) {
+	want := State{}
+	want.BuildState.Artifacts = map[string]string{"app": StatusComplete, "worker": StatusInProgress}
+	want.DeployState.Status = StatusComplete
+	want.StatusCheckState.Status = StatusCheckSucceeded
+
+	got, err := decodeStateV1(encodeStateV1(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeStateV1() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeLogEntryV1(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+	tests := []struct {
+		name  string
+		entry LogEntry
+	}{
+		{"build", LogEntry{Entry: "Build started", Event: Event{BuildEvent: &BuildEvent{Artifact: "app", Status: StatusInProgress}}}},
+		{"deploy", LogEntry{Entry: "Deploy failed", Event: Event{DeployEvent: &DeployEvent{Status: StatusFailed, Err: "oops"}}}},
+		{"status check", LogEntry{Event: Event{StatusCheckEvent: &StatusCheckEvent{Status: StatusCheckSucceeded, Message: "ok"}}}},
+		{"termination", LogEntry{Event: Event{TerminationEvent: &TerminationEvent{Status: "Completed"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeLogEntryV1(encodeLogEntryV1(at, tt.entry))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := time.Parse(time.RFC3339Nano, got.Timestamp)
+			if err != nil || !parsed.Equal(at) {
+				t.Errorf("timestamp = %s, want %s", got.Timestamp, at.Format(time.RFC3339Nano))
+			}
+
+			want := tt.entry
+			want.Timestamp = got.Timestamp
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decodeLogEntryV1() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformedMessage(t *testing.T) {
+	// The length of the bytes field is past the end of the message
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	b = protowire.AppendVarint(b, 100)
+
+	if _, err := decodeStateV1(b); err != errBadProtoMessage {
+		t.Errorf("decodeStateV1() error = %v, want %v", err, errBadProtoMessage)
+	}
+
+	if _, err := decodeLogEntryV1(b); err != errBadProtoMessage {
+		t.Errorf("decodeLogEntryV1() error = %v, want %v", err, errBadProtoMessage)
+	}
+}
+
+// TestGRPCClient runs the client against the service that answers with the raw messages as skaffold would
+func TestGRPCClient(t *testing.T) {
+	state := State{}
+	state.BuildState.Artifacts = map[string]string{"app": "Complete"}
+	state.DeployState.Status = "Complete"
+	state.StatusCheckState.Status = "Succeeded"
+
+	at := time.Now()
+	event := LogEntry{Event: Event{BuildEvent: &BuildEvent{Artifact: "app", Status: "In Progress"}}}
+
+	executed := make(chan []byte, 1)
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+
+			in := []byte{}
+			if err := stream.RecvMsg(&in); err != nil {
+				return err
+			}
+
+			switch method {
+			case grpcGetStateMethod:
+				return stream.SendMsg(encodeStateV1(state))
+			case grpcEventsMethod:
+				return stream.SendMsg(encodeLogEntryV1(at, event))
+			case grpcExecuteMethod:
+				executed <- in
+				return stream.SendMsg([]byte{})
+			}
+
+			return nil
+		}),
+	)
+	defer server.Stop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+
+	client, err := NewGRPCClient(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	gotState, err := client.GetState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotState, state) {
+		t.Errorf("GetState() = %+v, want %+v", gotState, state)
+	}
+
+	stream, err := client.Events(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	entry, err := stream.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entry.Event, event.Event) {
+		t.Errorf("Next() = %+v, want %+v", entry.Event, event.Event)
+	}
+
+	if err := client.Execute(ctx, Intent{Build: true, Deploy: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// UserIntentRequest { Intent intent = 1; }, Intent { bool build = 1; bool sync = 2; bool deploy = 3; }
+	intent := map[protowire.Number]uint64{}
+	err = walkMessage(<-executed, func(num protowire.Number, _ uint64, b []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		return walkMessage(b, func(num protowire.Number, varint uint64, _ []byte) error {
+			intent[num] = varint
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[protowire.Number]uint64{1: 1, 3: 1}
+	if !reflect.DeepEqual(intent, want) {
+		t.Errorf("Execute() intent fields = %v, want %v", intent, want)
+	}
+}
+
+func TestNewAPIClientRejectsV2OverGRPC(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GRPCAddr = "127.0.0.1:50051"
+	cfg.APIVersion = APIVersionV2
+
+	if _, err := NewAPIClient(cfg); err == nil {
+		t.Fatal("NewAPIClient() of v2 over gRPC succeeded")
+	}
+
+	cfg.APIVersion = APIVersionAuto
+	client, err := NewAPIClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := client.Version(context.Background()); v != APIVersionV1 {
+		t.Errorf("Version() over gRPC = %s, want v1", v)
+	}
+}
@@ -0,0 +1,237 @@
+package skaffold
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HTTPClient talks to the skaffold HTTP gateway (--rpc-http-port)
+type HTTPClient struct {
+	addr   string
+	client *http.Client
+
+	version string
+
+	mu         sync.Mutex
+	negotiated string
+}
+
+func NewHTTPClient(addr, version string) *HTTPClient {
+	if len(version) == 0 {
+		version = APIVersionAuto
+	}
+
+	return &HTTPClient{
+		addr:    addr,
+		client:  &http.Client{},
+		version: version,
+	}
+}
+
+// Version asks /v2/state then /v1/state, the first answered one wins. The negotiated
+// version is kept until skaffold stops answering
+func (c *HTTPClient) Version(ctx context.Context) (string, error) {
+	if c.version != APIVersionAuto {
+		return c.version, nil
+	}
+
+	c.mu.Lock()
+	negotiated := c.negotiated
+	c.mu.Unlock()
+
+	if len(negotiated) > 0 {
+		return negotiated, nil
+	}
+
+	for _, v := range []string{APIVersionV2, APIVersionV1} {
+		resp, err := c.get(ctx, "/"+v+"/state")
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			c.mu.Lock()
+			c.negotiated = v
+			c.mu.Unlock()
+
+			return v, nil
+		}
+	}
+
+	return "", ErrAPIVersionNotSupported
+}
+
+func (c *HTTPClient) GetState(ctx context.Context) (State, error) {
+	state := State{}
+
+	version, err := c.Version(ctx)
+	if err != nil {
+		return state, err
+	}
+
+	resp, err := c.get(ctx, "/"+version+"/state")
+	if err != nil {
+		return state, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return state, fmt.Errorf("skaffold state: unexpected status %s", resp.Status)
+	}
+
+	// v1 and v2 states have the same shape, the statuses differ
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return state, err
+	}
+
+	return normalizeState(state), nil
+}
+
+func (c *HTTPClient) Events(ctx context.Context) (EventStream, error) {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.get(ctx, "/"+version+"/events")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("skaffold events: unexpected status %s", resp.Status)
+	}
+
+	return &httpEventStream{
+		version: version,
+		body:    resp.Body,
+		decoder: json.NewDecoder(resp.Body),
+	}, nil
+}
+
+func (c *HTTPClient) Execute(ctx context.Context, intent Intent) error {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+c.addr+"/"+version+"/execute", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("skaffold execute: unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (c *HTTPClient) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+c.addr+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// skaffold may come back with another version
+		c.mu.Lock()
+		c.negotiated = ""
+		c.mu.Unlock()
+	}
+
+	return resp, err
+}
+
+type streamItem struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// httpEventStream reads the newline-delimited JSON of /v1/events or /v2/events
+type httpEventStream struct {
+	version string
+	body    io.ReadCloser
+	decoder *json.Decoder
+}
+
+// Next blocks until the next event; the decoder buffers the body, so events split
+// between chunks are read whole
+func (es *httpEventStream) Next() (LogEntry, error) {
+	for {
+		item := streamItem{}
+		if err := es.decoder.Decode(&item); err != nil {
+			return LogEntry{}, err
+		}
+
+		if item.Error != nil {
+			return LogEntry{}, fmt.Errorf("skaffold events: %s", item.Error.Message)
+		}
+
+		if len(item.Result) == 0 {
+			continue
+		}
+
+		if es.version == APIVersionV2 {
+			event := EventV2{}
+			if err := json.Unmarshal(item.Result, &event); err != nil {
+				return LogEntry{}, err
+			}
+
+			entry, ok := event.LogEntry()
+			if !ok {
+				continue
+			}
+
+			return entry, nil
+		}
+
+		entry := LogEntry{}
+		if err := json.Unmarshal(item.Result, &entry); err != nil {
+			return LogEntry{}, err
+		}
+
+		return normalizeLogEntry(entry), nil
+	}
+}
+
+func (es *httpEventStream) Close() error {
+	return es.body.Close()
+}
+
+func normalizeLogEntry(entry LogEntry) LogEntry {
+	e := &entry.Event
+
+	switch {
+	case e.BuildEvent != nil:
+		e.BuildEvent.Status = normalizeStatus(e.BuildEvent.Status)
+	case e.DeployEvent != nil:
+		e.DeployEvent.Status = normalizeStatus(e.DeployEvent.Status)
+	case e.StatusCheckEvent != nil:
+		e.StatusCheckEvent.Status = normalizeStatusCheckStatus(e.StatusCheckEvent.Status)
+	}
+
+	return entry
+}
@@ -0,0 +1,412 @@
+package skaffold
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"skasync/pkg/docker"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// skaffoldStub serves the state and the events of the given API versions, the events are
+// written to the open streams by send
+type skaffoldStub struct {
+	mu       sync.Mutex
+	versions map[string]bool
+	state    string
+	requests []string
+	streams  []chan string
+}
+
+func newSkaffoldStub(t *testing.T, state string, versions ...string) (*skaffoldStub, *httptest.Server) {
+	stub := &skaffoldStub{
+		versions: make(map[string]bool),
+		state:    state,
+	}
+
+	for _, v := range versions {
+		stub.versions[v] = true
+	}
+
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	return stub, server
+}
+
+func (s *skaffoldStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	state := s.state
+	isServed := len(parts) == 2 && s.versions[parts[0]]
+	s.mu.Unlock()
+
+	if !isServed {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch parts[1] {
+	case "state":
+		fmt.Fprint(w, state)
+	case "execute":
+		fmt.Fprint(w, "{}")
+	case "events":
+		ch := make(chan string, 10)
+
+		s.mu.Lock()
+		s.streams = append(s.streams, ch)
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case result := <-ch:
+				fmt.Fprintf(w, "{\"result\":%s}\n", result)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// send writes the event to every open stream, the timestamp is set to now
+func (s *skaffoldStub) send(t *testing.T, event map[string]interface{}) {
+	event["timestamp"] = time.Now().Format(time.RFC3339Nano)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	streams := s.streams
+	s.mu.Unlock()
+
+	for _, ch := range streams {
+		ch <- string(data)
+	}
+}
+
+func (s *skaffoldStub) setVersions(versions ...string) {
+	s.mu.Lock()
+	s.versions = make(map[string]bool)
+	for _, v := range versions {
+		s.versions[v] = true
+	}
+	s.mu.Unlock()
+}
+
+func (s *skaffoldStub) countRequests(request string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, r := range s.requests {
+		if r == request {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (s *skaffoldStub) waitStreams(t *testing.T, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.streams)
+		s.mu.Unlock()
+
+		if n >= count {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d event streams are opened, want %d", n, count)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func addr(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestHTTPClientVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		config   string
+		want     string
+		wantErr  error
+	}{
+		{name: "v2 is preferred", versions: []string{APIVersionV1, APIVersionV2}, config: APIVersionAuto, want: APIVersionV2},
+		{name: "v1 fallback", versions: []string{APIVersionV1}, config: APIVersionAuto, want: APIVersionV1},
+		{name: "configured version is not probed", versions: []string{APIVersionV2}, config: APIVersionV1, want: APIVersionV1},
+		{name: "no version", versions: nil, config: APIVersionAuto, wantErr: ErrAPIVersionNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, server := newSkaffoldStub(t, "{}", tt.versions...)
+			client := NewHTTPClient(addr(server), tt.config)
+
+			for i := 0; i < 2; i++ {
+				got, err := client.Version(context.Background())
+				if err != tt.wantErr {
+					t.Fatalf("Version() error = %v, want %v", err, tt.wantErr)
+				}
+				if got != tt.want {
+					t.Fatalf("Version() = %s, want %s", got, tt.want)
+				}
+			}
+
+			probes := stub.countRequests("GET /v2/state")
+			switch {
+			case tt.config != APIVersionAuto && probes != 0:
+				t.Errorf("configured version is probed %d times", probes)
+			case tt.wantErr == nil && tt.config == APIVersionAuto && probes != 1:
+				// The negotiated version is kept
+				t.Errorf("v2 is probed %d times, want once", probes)
+			}
+		})
+	}
+}
+
+func TestHTTPClientVersionIsRenegotiated(t *testing.T) {
+	stub, server := newSkaffoldStub(t, "{}", APIVersionV2)
+	client := NewHTTPClient(addr(server), APIVersionAuto)
+
+	if v, err := client.Version(context.Background()); err != nil || v != APIVersionV2 {
+		t.Fatalf("Version() = %s, %v, want v2", v, err)
+	}
+
+	server.Close()
+	if _, err := client.GetState(context.Background()); err == nil {
+		t.Fatal("GetState() of the stopped skaffold succeeded")
+	}
+
+	// skaffold is restarted with another version at the same address
+	listener, err := net.Listen("tcp", addr(server))
+	if err != nil {
+		t.Skipf("address of the stopped skaffold is taken: %s", err)
+	}
+
+	stub.setVersions(APIVersionV1)
+	restarted := &httptest.Server{Listener: listener, Config: &http.Server{Handler: stub}}
+	restarted.Start()
+	defer restarted.Close()
+
+	if v, err := client.Version(context.Background()); err != nil || v != APIVersionV1 {
+		t.Fatalf("Version() after restart = %s, %v, want v1", v, err)
+	}
+}
+
+func TestHTTPClientGetState(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		state   string
+	}{
+		{
+			name:    "v1",
+			version: APIVersionV1,
+			state:   `{"buildState":{"artifacts":{"app":"Complete"}},"deployState":{"status":"Complete"},"statusCheckState":{"status":"Succeeded"}}`,
+		},
+		{
+			name:    "v2",
+			version: APIVersionV2,
+			state:   `{"buildState":{"artifacts":{"app":"Succeeded"}},"deployState":{"status":"Succeeded"},"statusCheckState":{"status":"Succeeded"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newSkaffoldStub(t, tt.state, tt.version)
+			client := NewHTTPClient(addr(server), APIVersionAuto)
+
+			state, err := client.GetState(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := state.BuildState.Artifacts["app"]; got != StatusComplete {
+				t.Errorf("artifact status = %q, want %q", got, StatusComplete)
+			}
+			if state.DeployState.Status != StatusComplete {
+				t.Errorf("deploy status = %q, want %q", state.DeployState.Status, StatusComplete)
+			}
+			if state.StatusCheckState.Status != StatusCheckSucceeded {
+				t.Errorf("status check status = %q, want %q", state.StatusCheckState.Status, StatusCheckSucceeded)
+			}
+		})
+	}
+}
+
+func TestHTTPClientEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		events  []map[string]interface{}
+		want    []Event
+	}{
+		{
+			name:    "v1",
+			version: APIVersionV1,
+			events: []map[string]interface{}{
+				{"event": map[string]interface{}{"buildEvent": map[string]string{"artifact": "app", "status": "In Progress"}}},
+				{"event": map[string]interface{}{"deployEvent": map[string]string{"status": "Complete"}}},
+			},
+			want: []Event{
+				{BuildEvent: &BuildEvent{Artifact: "app", Status: StatusInProgress}},
+				{DeployEvent: &DeployEvent{Status: StatusComplete}},
+			},
+		},
+		{
+			name:    "v2",
+			version: APIVersionV2,
+			events: []map[string]interface{}{
+				{"buildSubtaskEvent": map[string]string{"artifact": "app", "step": "Build", "status": "InProgress"}},
+				// The cache step doesn't affect the readiness and is skipped
+				{"buildSubtaskEvent": map[string]string{"artifact": "app", "step": "Cache", "status": "Succeeded"}},
+				{"taskEvent": map[string]interface{}{"task": "StatusCheck", "iteration": 1, "status": "Succeeded"}},
+			},
+			want: []Event{
+				{BuildEvent: &BuildEvent{Artifact: "app", Status: StatusInProgress}},
+				{StatusCheckEvent: &StatusCheckEvent{Status: StatusCheckSucceeded}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, server := newSkaffoldStub(t, "{}", tt.version)
+			client := NewHTTPClient(addr(server), APIVersionAuto)
+
+			stream, err := client.Events(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+
+			stub.waitStreams(t, 1)
+			for _, event := range tt.events {
+				stub.send(t, event)
+			}
+
+			for _, want := range tt.want {
+				entry, err := stream.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got, _ := json.Marshal(entry.Event)
+				wantJSON, _ := json.Marshal(want)
+				if string(got) != string(wantJSON) {
+					t.Errorf("event = %s, want %s", got, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPClientExecute(t *testing.T) {
+	stub, server := newSkaffoldStub(t, "{}", APIVersionV2)
+	client := NewHTTPClient(addr(server), APIVersionAuto)
+
+	if err := client.Execute(context.Background(), Intent{Build: true, Deploy: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := stub.countRequests("POST /v2/execute"); n != 1 {
+		t.Errorf("execute is requested %d times, want once", n)
+	}
+}
+
+func TestStatusProbe(t *testing.T) {
+	deployed := `{"buildState":{"artifacts":{"app":"Succeeded"}},"deployState":{"status":"Succeeded"},"statusCheckState":{"status":"Succeeded"}}`
+	stub, server := newSkaffoldStub(t, deployed, APIVersionV2)
+
+	// No endpoint is bound, the readiness of the artifact is reported anyway
+	artifactService := docker.NewArtifactService(t.TempDir())
+	if err := artifactService.Register("app", docker.ArtifactConfig{Image: "app", RootDir: "/app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	probe := NewStatusProbe(NewHTTPClient(addr(server), APIVersionAuto), artifactService)
+
+	statusCh := make(chan SkaffoldProcessStatus, 10)
+	probe.Subscribe(func(status SkaffoldProcessStatus) {
+		statusCh <- status
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go probe.Listen(ctx)
+
+	expectReady := func(want bool) {
+		t.Helper()
+
+		select {
+		case status := <-statusCh:
+			if status.IsReady != want {
+				t.Fatalf("IsReady = %v, want %v (%+v)", status.IsReady, want, status)
+			}
+			if status.IsArtifactReady("app") != want {
+				t.Fatalf("IsArtifactReady(app) = %v, want %v (%+v)", status.IsArtifactReady("app"), want, status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("status is not published")
+		}
+	}
+
+	// The state read after the stream is opened
+	expectReady(true)
+
+	stub.waitStreams(t, 1)
+
+	// The image is rebuilt, it is pending until the new deploy is done
+	stub.send(t, map[string]interface{}{"buildSubtaskEvent": map[string]string{"artifact": "app", "step": "Build", "status": "InProgress"}})
+	expectReady(false)
+
+	stub.send(t, map[string]interface{}{"buildSubtaskEvent": map[string]string{"artifact": "app", "step": "Build", "status": "Succeeded"}})
+	expectReady(false)
+
+	stub.send(t, map[string]interface{}{"deploySubtaskEvent": map[string]string{"status": "InProgress"}})
+	expectReady(false)
+
+	stub.send(t, map[string]interface{}{"deploySubtaskEvent": map[string]string{"status": "Succeeded"}})
+	expectReady(true)
+
+	// The probe polls the state once skaffold is gone
+	server.CloseClientConnections()
+	server.Close()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-statusCh:
+			if status.DoesNotAnswer {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stopped skaffold is not reported")
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package skaffold
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"skasync/pkg/docker"
+	"skasync/pkg/k8s"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImportResult holds the artifacts and endpoints read from skaffold.yaml,
+// all paths are relative to the skaffold.yaml dir
+type ImportResult struct {
+	Artifacts map[string]docker.ArtifactConfig
+	Endpoints map[string]k8s.EndpointConfig
+}
+
+type workloadYaml struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Selector struct {
+			MatchLabels map[string]string `yaml:"matchLabels"`
+		} `yaml:"selector"`
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Name  string `yaml:"name"`
+					Image string `yaml:"image"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+// Import reads artifacts from build.artifacts of skaffold.yaml and endpoints from
+// the workloads of its kubectl manifests that run the artifact images
+func Import(skaffoldFilePath string, profiles []string) (ImportResult, error) {
+	result := ImportResult{
+		Artifacts: make(map[string]docker.ArtifactConfig),
+		Endpoints: make(map[string]k8s.EndpointConfig),
+	}
+
+	configs, err := ReadSkaffoldConfigs(skaffoldFilePath, profiles)
+	if err != nil {
+		return result, err
+	}
+
+	skaffoldDir := filepath.Dir(skaffoldFilePath)
+
+	artifactIds := make(map[string]string)
+	manifests := make([]string, 0)
+
+	for _, cfg := range configs {
+		for _, artifact := range cfg.Build.Artifacts {
+			id := artifactId(artifact.Image, result.Artifacts)
+			result.Artifacts[id] = convertArtifact(artifact)
+			artifactIds[artifact.Image] = id
+		}
+
+		manifests = append(manifests, cfg.ManifestPaths()...)
+	}
+
+	for _, pattern := range manifests {
+		manifestPaths, err := filepath.Glob(filepath.Join(skaffoldDir, pattern))
+		if err != nil {
+			return result, err
+		}
+
+		sort.Strings(manifestPaths)
+
+		for _, manifestPath := range manifestPaths {
+			if err := readManifestEndpoints(manifestPath, artifactIds, result.Endpoints); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func convertArtifact(artifact ArtifactYaml) docker.ArtifactConfig {
+	contextDir := artifact.Context
+	if len(contextDir) == 0 {
+		contextDir = "."
+	}
+
+	dockerfile := artifact.Docker.Dockerfile
+	if len(dockerfile) == 0 {
+		dockerfile = docker.DockerfileName
+	}
+
+	cfg := docker.ArtifactConfig{
+		Image:         artifact.Image,
+		Context:       contextDir,
+		DockerfileDir: filepath.Dir(filepath.Join(contextDir, dockerfile)),
+		Dockerfile:    filepath.Base(dockerfile),
+	}
+
+	if len(artifact.Docker.BuildArgs) > 0 {
+		cfg.BuildArgs = make(map[string]string)
+		for key, value := range artifact.Docker.BuildArgs {
+			if value != nil {
+				cfg.BuildArgs[key] = *value
+			}
+		}
+	}
+
+	// sync.infer and sync.auto are covered by the dockerfile inferring
+	if artifact.Sync != nil {
+		for _, rule := range artifact.Sync.Manual {
+			cfg.Sync = append(cfg.Sync, docker.SyncRule{
+				Src:   rule.Src,
+				Dest:  rule.Dest,
+				Strip: rule.Strip,
+			})
+		}
+	}
+
+	return cfg
+}
+
+func artifactId(image string, artifacts map[string]docker.ArtifactConfig) string {
+	id := path.Base(image)
+	if _, exist := artifacts[id]; !exist {
+		return id
+	}
+
+	return image
+}
+
+func readManifestEndpoints(manifestPath string, artifactIds map[string]string, endpoints map[string]k8s.EndpointConfig) error {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		workload := workloadYaml{}
+		if err := decoder.Decode(&workload); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return fmt.Errorf("%s: %w", manifestPath, err)
+		}
+
+		switch workload.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet":
+		default:
+			continue
+		}
+
+		selector := labelsToSelector(workload.Spec.Selector.MatchLabels)
+		if len(selector) == 0 {
+			continue
+		}
+
+		containers := workload.Spec.Template.Spec.Containers
+		for _, container := range containers {
+			id, ok := artifactIds[docker.ImageName(container.Image)]
+			if !ok {
+				continue
+			}
+
+			name := workload.Metadata.Name
+			if len(containers) > 1 {
+				name += "-" + container.Name
+			}
+
+			endpoints[name] = k8s.EndpointConfig{
+				Artifact:  id,
+				Selector:  selector,
+				Container: container.Name,
+				Namespace: workload.Metadata.Namespace,
+			}
+		}
+	}
+}
+
+func labelsToSelector(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,350 @@
+package skaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrProfileNotFound = errors.New("skaffold profile not found")
+)
+
+// SkaffoldConfig is the part of skaffold.yaml used by skasync
+type SkaffoldConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Build struct {
+		Artifacts []ArtifactYaml `yaml:"artifacts"`
+	} `yaml:"build"`
+	Manifests struct {
+		RawYaml []string `yaml:"rawYaml"`
+	} `yaml:"manifests"`
+	Deploy struct {
+		Kubectl struct {
+			Manifests []string `yaml:"manifests"`
+		} `yaml:"kubectl"`
+	} `yaml:"deploy"`
+}
+
+type ArtifactYaml struct {
+	Image   string `yaml:"image"`
+	Context string `yaml:"context"`
+	Docker  struct {
+		Dockerfile string             `yaml:"dockerfile"`
+		BuildArgs  map[string]*string `yaml:"buildArgs"`
+	} `yaml:"docker"`
+	Sync *struct {
+		Manual []struct {
+			Src   string `yaml:"src"`
+			Dest  string `yaml:"dest"`
+			Strip string `yaml:"strip"`
+		} `yaml:"manual"`
+		Infer []string `yaml:"infer"`
+		Auto  *bool    `yaml:"auto"`
+	} `yaml:"sync"`
+}
+
+// ManifestPaths returns the kubectl manifests of both v1 (deploy.kubectl) and v2 (manifests.rawYaml) schemas
+func (sc SkaffoldConfig) ManifestPaths() []string {
+	paths := make([]string, 0, len(sc.Manifests.RawYaml)+len(sc.Deploy.Kubectl.Manifests))
+	paths = append(paths, sc.Manifests.RawYaml...)
+	paths = append(paths, sc.Deploy.Kubectl.Manifests...)
+
+	return paths
+}
+
+type jsonPatch struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from"`
+	Value interface{} `yaml:"value"`
+}
+
+// ReadSkaffoldConfigs reads every config document of skaffold.yaml and applies the profiles in order
+func ReadSkaffoldConfigs(filePath string, profiles []string) ([]SkaffoldConfig, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]SkaffoldConfig, 0, 1)
+	foundProfiles := make(map[string]bool)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := make(map[string]interface{})
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+
+		if kind, _ := doc["kind"].(string); len(kind) > 0 && kind != "Config" {
+			continue
+		}
+
+		for _, profileName := range profiles {
+			applied, err := applyProfile(doc, profileName)
+			if err != nil {
+				return nil, fmt.Errorf("%s: profile \"%s\": %w", filePath, profileName, err)
+			}
+
+			foundProfiles[profileName] = foundProfiles[profileName] || applied
+		}
+
+		delete(doc, "profiles")
+
+		docData, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := SkaffoldConfig{}
+		if err := yaml.Unmarshal(docData, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+
+		configs = append(configs, cfg)
+	}
+
+	for _, profileName := range profiles {
+		if !foundProfiles[profileName] {
+			return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, profileName)
+		}
+	}
+
+	return configs, nil
+}
+
+func applyProfile(doc map[string]interface{}, profileName string) (bool, error) {
+	profiles, _ := doc["profiles"].([]interface{})
+
+	for _, p := range profiles {
+		profile, ok := p.(map[string]interface{})
+		if !ok || profile["name"] != profileName {
+			continue
+		}
+
+		for key, value := range profile {
+			switch key {
+			case "name", "activation", "requiresAllActivations", "patches":
+				continue
+			}
+
+			doc[key] = overlay(doc[key], value)
+		}
+
+		patchesData, err := yaml.Marshal(profile["patches"])
+		if err != nil {
+			return true, err
+		}
+
+		patches := make([]jsonPatch, 0)
+		if err := yaml.Unmarshal(patchesData, &patches); err != nil {
+			return true, err
+		}
+
+		for _, patch := range patches {
+			if err := applyPatch(doc, patch); err != nil {
+				return true, fmt.Errorf("patch %s %s: %w", patch.Op, patch.Path, err)
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// overlay merges the profile section into the base one, lists and scalars are replaced
+func overlay(base, value interface{}) interface{} {
+	baseMap, ok := base.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	for key := range valueMap {
+		baseMap[key] = overlay(baseMap[key], valueMap[key])
+	}
+
+	return baseMap
+}
+
+func applyPatch(doc map[string]interface{}, patch jsonPatch) error {
+	switch patch.Op {
+	case "add", "replace":
+		return setByPointer(doc, patch.Path, patch.Value, patch.Op == "add")
+	case "remove":
+		_, err := removeByPointer(doc, patch.Path)
+		return err
+	case "move", "copy":
+		value, err := getByPointer(doc, patch.From)
+		if err != nil {
+			return err
+		}
+
+		if patch.Op == "move" {
+			if _, err := removeByPointer(doc, patch.From); err != nil {
+				return err
+			}
+		}
+
+		return setByPointer(doc, patch.Path, value, true)
+	default:
+		return fmt.Errorf("unsupported patch operation \"%s\"", patch.Op)
+	}
+}
+
+func splitPointer(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return []string{}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(parts[i], "~1", "/"), "~0", "~")
+	}
+
+	return parts
+}
+
+func getByPointer(doc interface{}, pointer string) (interface{}, error) {
+	node := doc
+
+	for _, part := range splitPointer(pointer) {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, ok := n[part]
+			if !ok {
+				return nil, fmt.Errorf("path \"%s\" not found", pointer)
+			}
+
+			node = value
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("path \"%s\" not found", pointer)
+			}
+
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path \"%s\" not found", pointer)
+		}
+	}
+
+	return node, nil
+}
+
+func setByPointer(doc map[string]interface{}, pointer string, value interface{}, isAdd bool) error {
+	parts := splitPointer(pointer)
+	if len(parts) == 0 {
+		return errors.New("empty patch path")
+	}
+
+	parentPointer := "/" + strings.Join(escapePointerParts(parts[:len(parts)-1]), "/")
+	parent, err := getByPointer(doc, parentPointer)
+	if err != nil {
+		return err
+	}
+
+	key := parts[len(parts)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[key]; !ok && !isAdd {
+			return fmt.Errorf("path \"%s\" not found", pointer)
+		}
+
+		p[key] = value
+	case []interface{}:
+		var list []interface{}
+
+		if key == "-" && isAdd {
+			list = append(p, value)
+		} else {
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i > len(p) || (!isAdd && i == len(p)) {
+				return fmt.Errorf("path \"%s\" not found", pointer)
+			}
+
+			if isAdd {
+				list = append(list, p[:i]...)
+				list = append(list, value)
+				list = append(list, p[i:]...)
+			} else {
+				p[i] = value
+				list = p
+			}
+		}
+
+		return setByPointer(doc, parentPointer, list, false)
+	default:
+		return fmt.Errorf("path \"%s\" not found", pointer)
+	}
+
+	return nil
+}
+
+func removeByPointer(doc map[string]interface{}, pointer string) (interface{}, error) {
+	parts := splitPointer(pointer)
+	if len(parts) == 0 {
+		return nil, errors.New("empty patch path")
+	}
+
+	parentPointer := "/" + strings.Join(escapePointerParts(parts[:len(parts)-1]), "/")
+	parent, err := getByPointer(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+
+	key := parts[len(parts)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		value, ok := p[key]
+		if !ok {
+			return nil, fmt.Errorf("path \"%s\" not found", pointer)
+		}
+
+		delete(p, key)
+		return value, nil
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(p) {
+			return nil, fmt.Errorf("path \"%s\" not found", pointer)
+		}
+
+		value := p[i]
+		list := append(append([]interface{}{}, p[:i]...), p[i+1:]...)
+
+		return value, setByPointer(doc, parentPointer, list, false)
+	default:
+		return nil, fmt.Errorf("path \"%s\" not found", pointer)
+	}
+}
+
+func escapePointerParts(parts []string) []string {
+	escaped := make([]string, 0, len(parts))
+	for _, part := range parts {
+		escaped = append(escaped, strings.ReplaceAll(strings.ReplaceAll(part, "~", "~0"), "/", "~1"))
+	}
+
+	return escaped
+}
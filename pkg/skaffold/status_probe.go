@@ -2,191 +2,264 @@ package skaffold
 
 import (
 	"context"
-	"encoding/json"
-	"io"
-	"net/http"
-	"skasync/pkg/k8s"
+	"fmt"
+	"skasync/pkg/docker"
 	"sync"
 	"time"
 )
 
-type StatusProbe struct {
-	listenAddr string
-
-	podsCtrl *k8s.EndpointCtrl
-	eventsCh chan EventPkg
+const (
+	pollInterval        = time.Millisecond * 500
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Second * 10
+)
 
-	mu          sync.Mutex
+type StatusProbe struct {
+	client APIClient
+	// artifactService lists the images of every endpoint, bound to a pod or not
+	artifactService *docker.ArtifactService
+
+	mu    sync.Mutex
+	state State
+	// pending are the images rebuilt since the last deploy, the value is true once
+	// the deploy of the new image has started
+	pending     map[string]bool
 	subscribers []func(SkaffoldProcessStatus)
 }
 
 type SkaffoldProcessStatus struct {
 	Deploy    string
 	Artifacts map[string]string
+	// ReadyArtifacts reports per image whether its endpoints can be synced
+	ReadyArtifacts map[string]bool
+	// IsReady is true when the whole deploy is done and no rebuild is pending
 	IsReady,
 	DoesNotAnswer bool
 }
 
-type EventPkg struct {
-	Result map[string]struct {
-		Timestamp string                 `json:"timestamp"`
-		Entry     string                 `json:"entry"`
-		Event     map[string]interface{} `json:"event"`
-	} `json:"result"`
+// IsArtifactReady reports whether the endpoints of the image can be synced
+func (s SkaffoldProcessStatus) IsArtifactReady(image string) bool {
+	return s.ReadyArtifacts[image]
 }
 
-func NewStatusProbe(listenAddr string, podsCtrl *k8s.EndpointCtrl) *StatusProbe {
+func NewStatusProbe(client APIClient, artifactService *docker.ArtifactService) *StatusProbe {
 	return &StatusProbe{
-		listenAddr:  listenAddr,
-		podsCtrl:    podsCtrl,
-		subscribers: make([]func(SkaffoldProcessStatus), 0),
+		client:          client,
+		artifactService: artifactService,
+		pending:         make(map[string]bool),
+		subscribers:     make([]func(SkaffoldProcessStatus), 0),
+	}
+}
+
+func (sp *StatusProbe) Subscribe(fn func(SkaffoldProcessStatus)) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.subscribers = append(sp.subscribers, fn)
+	return nil
+}
+
+// Listen follows the skaffold event stream and reconnects when it breaks.
+// While the stream is unavailable the state is polled
+func (sp *StatusProbe) Listen(ctx context.Context) error {
+	backoff := minReconnectBackoff
+
+	for {
+		isConnected, err := sp.listenEvents(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if isConnected {
+			backoff = minReconnectBackoff
+		}
 
-		// TODO
-		eventsCh: make(chan EventPkg, 10),
+		if err != nil && isConnected {
+			fmt.Printf("Skaffold event stream is broken: %s\n", err)
+		}
+
+		sp.poll(ctx, backoff)
+
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
 	}
 }
 
-// TODO
-func (sp *StatusProbe) listenEvents(ctx context.Context) error {
-	client := http.Client{
-		Timeout: time.Duration(1<<63 - 1), // forever
+// listenEvents reads the event stream until it breaks, isConnected reports whether the stream was opened
+func (sp *StatusProbe) listenEvents(ctx context.Context) (isConnected bool, err error) {
+	connectedAt := time.Now()
+
+	stream, err := sp.client.Events(ctx)
+	if err != nil {
+		return false, err
 	}
+	defer stream.Close()
 
-	resp, err := client.Get("http://" + sp.listenAddr + "/v1/events")
+	// The stream replays the history first, the state is the short way to the current status
+	state, err := sp.client.GetState(ctx)
 	if err != nil {
-		return err
+		return true, err
 	}
 
-	go func() {
-		<-ctx.Done()
-		resp.Body.Close()
-	}()
+	if version, err := sp.client.Version(ctx); err == nil {
+		fmt.Printf("Skaffold API %s event stream is connected\n", version)
+	}
 
-	bodyBuffer := make([]byte, 2048)
+	sp.setState(state)
+	sp.publish(sp.status(false))
 
 	for {
-		n, err := resp.Body.Read(bodyBuffer)
+		entry, err := stream.Next()
 		if err != nil {
-			if err == io.EOF {
-				return nil
-			}
-
-			return err
+			return true, err
 		}
 
-		eventPkgBytes := bodyBuffer[:n]
-
-		pkg := EventPkg{}
-		if err := json.Unmarshal(eventPkgBytes, &pkg); err != nil {
-			println(err.Error())
+		if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil && t.Before(connectedAt) {
 			continue
 		}
 
-		sp.eventsCh <- pkg
+		sp.mu.Lock()
+		isChanged := sp.state.Apply(entry.Event)
+		sp.trackPending()
+		sp.mu.Unlock()
+
+		if isChanged {
+			sp.publish(sp.status(false))
+		}
 	}
 }
 
-func (sp *StatusProbe) getState() (SkaffoldProcessStatus, error) {
-	client := http.Client{}
+func (sp *StatusProbe) poll(ctx context.Context, d time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
 
-	status := SkaffoldProcessStatus{}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	resp, err := client.Get("http://" + sp.listenAddr + "/v1/state")
-	if err != nil {
-		status.DoesNotAnswer = true
-		return status, nil
-	}
+	for {
+		select {
+		case <-ticker.C:
+			state, err := sp.client.GetState(ctx)
+			if err != nil {
+				sp.resetPending()
+				sp.publish(sp.status(true))
+				continue
+			}
 
-	if resp.StatusCode != http.StatusOK {
-		status.IsReady = false
-		return status, nil
+			sp.setState(state)
+			sp.publish(sp.status(false))
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return status, err
-	}
+func (sp *StatusProbe) setState(state State) {
+	sp.mu.Lock()
+	sp.state = state
+	sp.trackPending()
+	sp.mu.Unlock()
+}
 
-	state := make(map[string]interface{})
+func (sp *StatusProbe) resetPending() {
+	sp.mu.Lock()
+	sp.pending = make(map[string]bool)
+	sp.mu.Unlock()
+}
+
+func (sp *StatusProbe) isDeployed() bool {
+	return sp.state.DeployState.Status == StatusComplete &&
+		sp.state.StatusCheckState.Status == StatusCheckSucceeded
+}
 
-	if err := json.Unmarshal(data, &state); err != nil {
-		return status, err
+// trackPending follows the images from the build start to the end of their deploy. The deploy state
+// still shows the previous deploy until the new one starts, so the pending image is released only
+// after the deploy has been seen in progress. Must be called with the lock held
+func (sp *StatusProbe) trackPending() {
+	isDeployed := sp.isDeployed()
+
+	for image, status := range sp.state.BuildState.Artifacts {
+		switch status {
+		case StatusInProgress:
+			if _, ok := sp.pending[image]; !ok {
+				sp.pending[image] = false
+			}
+		case StatusFailed:
+			// Nothing is deployed after the failed build, the pods keep the previous image
+			delete(sp.pending, image)
+		}
 	}
 
-	deployStatus := ""
-	statusCheck := ""
-	buildArtifactsState := make(map[string]interface{})
+	for image, isDeployStarted := range sp.pending {
+		if sp.state.BuildState.Artifacts[image] != StatusComplete {
+			continue
+		}
 
-	if state["deployState"] != nil {
-		deployState := state["deployState"].(map[string]interface{})
-		deployStatus = deployState["status"].(string)
+		if !isDeployed {
+			sp.pending[image] = true
+		} else if isDeployStarted {
+			delete(sp.pending, image)
+		}
 	}
+}
 
-	if state["statusCheckState"] != nil {
-		statusCheckState := state["statusCheckState"].(map[string]interface{})
-		statusCheck = statusCheckState["status"].(string)
+// isArtifactReady must be called with the lock held
+func (sp *StatusProbe) isArtifactReady(image string) bool {
+	if _, ok := sp.pending[image]; ok {
+		return false
 	}
 
-	if state["buildState"] != nil {
-		buildState := state["buildState"].(map[string]interface{})
-		buildArtifactsState = buildState["artifacts"].(map[string]interface{})
+	// The deploy isn't caused by a build (first deploy, manifests change), it concerns every artifact
+	if len(sp.pending) == 0 && !sp.isDeployed() {
+		return false
 	}
 
-	artifacts := map[string]string{}
-
-	isReady := true
+	return sp.state.BuildState.Artifacts[image] != StatusInProgress
+}
 
-	if deployStatus != "Complete" {
-		isReady = false
+func (sp *StatusProbe) status(doesNotAnswer bool) SkaffoldProcessStatus {
+	status := SkaffoldProcessStatus{
+		Artifacts:      make(map[string]string),
+		ReadyArtifacts: make(map[string]bool),
 	}
 
-	if statusCheck != "Succeeded" {
-		isReady = false
+	if doesNotAnswer {
+		status.DoesNotAnswer = true
+		return status
 	}
 
-	for _, pod := range sp.podsCtrl.GetPods() {
-		artifactStatus, ok := buildArtifactsState[pod.Artifact.Image]
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	// Every artifact is reported, the endpoint bound after the publish finds its image here
+	for _, artifact := range sp.artifactService.List() {
+		image := artifact.Image
+		status.ReadyArtifacts[image] = sp.isArtifactReady(image)
+
+		artifactStatus, ok := sp.state.BuildState.Artifacts[image]
 		if !ok {
-			// return SkaffoldProcessStatus{}, fmt.Errorf("image \"%s\" not found in configuration", pod.Artifact)
-			artifacts[pod.Artifact.Image] = "Not found"
+			status.Artifacts[image] = "Not found"
 			continue
 		}
 
-		status := artifactStatus.(string)
-		artifacts[pod.Artifact.Image] = status
+		status.Artifacts[image] = artifactStatus
 	}
 
-	status.Deploy = deployStatus
-	status.Artifacts = artifacts
-	status.IsReady = isReady
+	status.Deploy = sp.state.DeployState.Status
+	status.IsReady = sp.isDeployed() && len(sp.pending) == 0
 
-	return status, nil
+	return status
 }
 
-func (sp *StatusProbe) Subscribe(fn func(SkaffoldProcessStatus)) error {
+func (sp *StatusProbe) publish(status SkaffoldProcessStatus) {
 	sp.mu.Lock()
-	defer sp.mu.Unlock()
-	sp.subscribers = append(sp.subscribers, fn)
-	return nil
-}
-
-func (sp *StatusProbe) Listen(ctx context.Context) error {
-	ticker := time.NewTicker(time.Millisecond * 500)
+	subscribers := sp.subscribers
+	sp.mu.Unlock()
 
-	for {
-		select {
-		case <-ticker.C:
-			state, err := sp.getState()
-			if err != nil {
-				return err
-			}
-
-			for _, sub := range sp.subscribers {
-				sub(state)
-			}
-		case <-ctx.Done():
-			ticker.Stop()
-			return nil
-		}
+	for _, sub := range subscribers {
+		sub(status)
 	}
 }
@@ -1,13 +1,45 @@
 package sync
 
+import "fmt"
+
 type Config struct {
 	AfterDeployOrStart []string
-	Debounce           int
+	// Debounce of the changes in milliseconds
+	Debounce int
+	// Delete files from endpoints when they become ignored after .dockerignore change
+	DeleteNewlyIgnored bool
+	// Journal of the not synced changes relative to the root dir, empty disables it
+	Journal string
+	// Ephemeral container attached to the endpoint containers without tar and sh
+	DebugContainer DebugContainerConfig
+}
+
+// DebugContainerConfig is the ephemeral container (kubectl debug --target) that writes the files
+// through /proc/<pid>/root of the target container process. It can't be removed from the pod, so it is reused
+type DebugContainerConfig struct {
+	Enabled bool
+	// Image with tar, rm, sh and grep
+	Image string
 }
 
 func DefaultConfig() Config {
 	return Config{
 		AfterDeployOrStart: []string{},
 		Debounce:           1000,
+		DeleteNewlyIgnored: false,
+		Journal:            ".skasync/journal.json",
+		DebugContainer: DebugContainerConfig{
+			Enabled: false,
+			Image:   "busybox:1.36",
+		},
 	}
 }
+
+// CheckConfig returns the error for the debounce that is not a positive number of milliseconds
+func CheckConfig(cfg Config) error {
+	if cfg.Debounce <= 0 {
+		return fmt.Errorf("Sync.Debounce must be a positive number of milliseconds, got %d", cfg.Debounce)
+	}
+
+	return nil
+}
@@ -1,38 +1,120 @@
 package sync
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"skasync/pkg/cli"
 	"skasync/pkg/docker"
 	"skasync/pkg/filemon"
 	"skasync/pkg/filesystem"
 	"skasync/pkg/k8s"
 	"skasync/pkg/util"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// ErrPathOutsideRoot is returned for the paths to sync that lead out of the root dir
+var ErrPathOutsideRoot = errors.New("path is outside of the root dir")
+
+// EndpointChangeMap is the change lists to sync by the endpoint tag
+type EndpointChangeMap map[string]filemon.ChangeList
+
+// SyncResult is the outcome of the change list sync to the endpoint
+type SyncResult struct {
+	TagName   string
+	Location  string
+	Files     []string
+	StartedAt time.Time
+	Duration  time.Duration
+	// Copied and Deleted are the files synced after the ignore rules and the mappings,
+	// Bytes is the size of the copied files written to all the sync containers
+	Copied,
+	Deleted int
+	// CopiedFiles and DeletedFiles are the synced files relative to the root dir
+	CopiedFiles,
+	DeletedFiles []string
+	Bytes int64
+	Err   error
+}
+
+// SyncStart is the change list sync of the watcher to the endpoint, published once the files
+// to sync are known. The syncs of nothing are not started
+type SyncStart struct {
+	TagName   string
+	Location  string
+	StartedAt time.Time
+	Copied,
+	Deleted int
+}
+
 type EndpointSyncker struct {
 	rootDir         string
-	cli             *cli.CLI
 	filesMapService *filesystem.FilesMapService
 	podsCtrl        *k8s.EndpointCtrl
+	debugCfg        DebugContainerConfig
+
+	mu               sync.Mutex
+	subscribers      []func(SyncResult)
+	startSubscribers []func(SyncStart)
+	// probeLocks serialize the transport detection per container, so the copy and delete of the same
+	// container attach a single debug container, the other containers are detected meanwhile
+	probeLocks map[string]*sync.Mutex
+	// transports are the detected ways to write to the containers by "context/namespace/pod/container"
+	transports map[string]transport
 }
 
-func NewEndpointSyncker(rootDir string, cli *cli.CLI, podsCtrl *k8s.EndpointCtrl, filesMapService *filesystem.FilesMapService) *EndpointSyncker {
+func NewEndpointSyncker(rootDir string, podsCtrl *k8s.EndpointCtrl, filesMapService *filesystem.FilesMapService, debugCfg DebugContainerConfig) *EndpointSyncker {
 	return &EndpointSyncker{
-		rootDir:         rootDir,
-		cli:             cli,
-		podsCtrl:        podsCtrl,
-		filesMapService: filesMapService,
+		rootDir:          rootDir,
+		podsCtrl:         podsCtrl,
+		filesMapService:  filesMapService,
+		debugCfg:         debugCfg,
+		subscribers:      make([]func(SyncResult), 0),
+		startSubscribers: make([]func(SyncStart), 0),
+		probeLocks:       make(map[string]*sync.Mutex),
+		transports:       make(map[string]transport),
+	}
+}
+
+// Subscribe is notified after every change list sync of the watcher to the endpoint
+func (k *EndpointSyncker) Subscribe(cb func(SyncResult)) {
+	k.mu.Lock()
+	k.subscribers = append(k.subscribers, cb)
+	k.mu.Unlock()
+}
+
+// SubscribeStart is notified before every change list sync of the watcher to the endpoint
+func (k *EndpointSyncker) SubscribeStart(cb func(SyncStart)) {
+	k.mu.Lock()
+	k.startSubscribers = append(k.startSubscribers, cb)
+	k.mu.Unlock()
+}
+
+func (k *EndpointSyncker) publishStart(start SyncStart) {
+	k.mu.Lock()
+	subscribers := k.startSubscribers
+	k.mu.Unlock()
+
+	for _, cb := range subscribers {
+		cb(start)
 	}
 }
 
-func (k *EndpointSyncker) Do(ctx context.Context, changeFilesCh chan filemon.ChangeList) error {
+func (k *EndpointSyncker) publish(result SyncResult) {
+	k.mu.Lock()
+	subscribers := k.subscribers
+	k.mu.Unlock()
+
+	for _, cb := range subscribers {
+		cb(result)
+	}
+}
+
+func (k *EndpointSyncker) Do(ctx context.Context, changeFilesCh chan EndpointChangeMap) error {
 	for {
 		select {
 		case changeFiles := <-changeFilesCh:
@@ -43,47 +125,90 @@ func (k *EndpointSyncker) Do(ctx context.Context, changeFilesCh chan filemon.Cha
 	}
 }
 
-func (k *EndpointSyncker) SyncLocalPathToPod(pod *k8s.Endpoint, localPath string) error {
+// SyncLocalPathToPod copies the file or the dir of the root dir to the endpoint. The error is
+// returned for the path, the sync error is kept in the result
+func (k *EndpointSyncker) SyncLocalPathToPod(pod *k8s.Endpoint, localPath string) (SyncResult, error) {
+	changeList, err := k.localPathChangeList(localPath)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	return k.syncChangeList(pod, changeList), nil
+}
+
+// SyncLocalPathToPods is SyncLocalPathToPod to every endpoint with a pod, the results are sorted by the tag
+func (k *EndpointSyncker) SyncLocalPathToPods(localPath string) ([]SyncResult, error) {
+	changeList, err := k.localPathChangeList(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := k.podsCtrl.GetPods()
+	results := make([]SyncResult, len(pods))
+
+	wg := sync.WaitGroup{}
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod *k8s.Endpoint) {
+			results[i] = k.syncChangeList(pod, changeList)
+			wg.Done()
+		}(i, pod)
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].TagName < results[j].TagName
+	})
+
+	return results, nil
+}
+
+// localPathChangeList lists the files of the path, the path must be within the root dir
+func (k *EndpointSyncker) localPathChangeList(localPath string) (filemon.ChangeList, error) {
 	absPath := filepath.Join(k.rootDir, localPath)
 
+	if relPath, err := filepath.Rel(k.rootDir, absPath); err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return filemon.ChangeList{}, ErrPathOutsideRoot
+	}
+
 	info, err := os.Stat(absPath)
-	if os.IsNotExist(err) {
-		return err
+	if err != nil {
+		return filemon.ChangeList{}, err
 	}
 
 	if !info.IsDir() {
-		changeList := filemon.ChangeFilesToChangeListConverter([]string{absPath})
-
-		k.syncEndpoint(pod, changeList, nil)
-		return nil
+		return filemon.ChangeFilesToChangeListConverter([]string{absPath}), nil
 	}
 
 	filesMap, err := k.filesMapService.WalkForSubpath(absPath)
 	if err != nil {
-		return err
+		return filemon.ChangeList{}, err
 	}
 
-	changeList := filemon.ChangeFilesToChangeListConverter(filesMap.ToSlice())
-
-	k.syncEndpoint(pod, changeList, nil)
-
-	return nil
+	return filemon.ChangeFilesToChangeListConverter(filesMap.ToSlice()), nil
 }
 
-func (k *EndpointSyncker) SyncLocalPathToPods(localPath string) error {
-	wg := sync.WaitGroup{}
-	for _, pod := range k.podsCtrl.GetPods() {
-		wg.Add(1)
-		go func(pod *k8s.Endpoint) {
-			k.SyncLocalPathToPod(pod, localPath)
-			wg.Done()
-		}(pod)
+func (k *EndpointSyncker) syncChangeList(pod *k8s.Endpoint, changeList filemon.ChangeList) SyncResult {
+	startedAt := time.Now()
+	modified, deleted, bytes, err := k.syncEndpoint(pod, changeList, nil, nil)
+
+	return SyncResult{
+		TagName:      pod.TagName,
+		Location:     pod.Location(),
+		Files:        changeList.AllFilePathsList(),
+		StartedAt:    startedAt,
+		Duration:     time.Since(startedAt),
+		Copied:       len(modified),
+		Deleted:      len(deleted),
+		CopiedFiles:  k.relPaths(modified),
+		DeletedFiles: k.relPaths(deleted),
+		Bytes:        bytes,
+		Err:          err,
 	}
-
-	wg.Wait()
-	return nil
 }
 
+// SyncLocalPathsToPods copies the local paths to the endpoints, the error lists every endpoint the sync has failed for
 func (k *EndpointSyncker) SyncLocalPathsToPods(pods []*k8s.Endpoint, localPaths []string, progressCh chan filesystem.TarProcessInfo) error {
 	filesMap := make(filesystem.FilesMap)
 
@@ -112,40 +237,105 @@ func (k *EndpointSyncker) SyncLocalPathsToPods(pods []*k8s.Endpoint, localPaths
 
 	awgStream := filesystem.NewTarProcessInfoAverage(progressCh)
 
+	errs := make([]error, len(pods))
+
 	wg := sync.WaitGroup{}
-	for _, pod := range pods {
+	for i, pod := range pods {
 		wg.Add(1)
-		go func(pod *k8s.Endpoint) {
+		go func(i int, pod *k8s.Endpoint) {
 			podProgressCh := make(chan filesystem.TarProcessInfo, 10)
 			go func() {
 				for {
 					awgStream.Set(pod.TagName, <-podProgressCh)
 				}
 			}()
-			k.syncEndpoint(pod, changeList, podProgressCh)
+			if _, _, _, err := k.syncEndpoint(pod, changeList, podProgressCh, nil); err != nil {
+				errs[i] = fmt.Errorf("%s (%s): %w", pod.TagName, pod.Location(), err)
+			}
 			wg.Done()
-		}(pod)
+		}(i, pod)
 	}
 
 	wg.Wait()
+
+	failed := make([]string, 0)
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("sync failed for %d of %d endpoints: %s", len(failed), len(pods), strings.Join(failed, "; "))
+	}
+
 	return nil
 }
 
-func (k *EndpointSyncker) do(changeList filemon.ChangeList) {
-	countChangedFiles := util.SafeCounter{}
+// IgnoreChangeToChangeList converts the files switched by the reloaded ignore rules to the change list
+// of the sync pipeline. The newly included files are copied, the newly excluded ones are deleted from
+// the endpoints of the artifact if deleteExcluded is set
+func IgnoreChangeToChangeList(change docker.IgnoreChange, deleteExcluded bool) filemon.ChangeList {
+	_, existed := filemon.CheckExistedFiles(change.Included...)
+	changeList := filemon.ChangeFilesToChangeListConverter(existed)
 
-	// changeList := filemon.ChangeFilesToChangeListConverter(changeFiles)
+	if !deleteExcluded {
+		return changeList
+	}
+
+	now := time.Now()
+	for _, filePath := range change.Excluded {
+		changeList.AddExcluded(change.ArtifactId, filePath, now)
+	}
+
+	return changeList
+}
+
+func (k *EndpointSyncker) do(changeMap EndpointChangeMap) {
+	countChangedFiles := util.SafeCounter{}
 
 	wg := sync.WaitGroup{}
 
 	for _, pod := range k.podsCtrl.GetPods() {
+		changeList, ok := changeMap[pod.TagName]
+		if !ok {
+			continue
+		}
+
 		wg.Add(1)
 
-		go func(_ep *k8s.Endpoint) {
-			modifiedLen, deletedLen := k.syncEndpoint(_ep, changeList, nil)
-			countChangedFiles.Add(modifiedLen + deletedLen)
+		go func(_ep *k8s.Endpoint, changeList filemon.ChangeList) {
+			startedAt := time.Now()
+			modified, deleted, bytes, err := k.syncEndpoint(_ep, changeList, nil, func(modifiedLen, deletedLen int) {
+				k.publishStart(SyncStart{
+					TagName:   _ep.TagName,
+					Location:  _ep.Location(),
+					StartedAt: startedAt,
+					Copied:    modifiedLen,
+					Deleted:   deletedLen,
+				})
+			})
+			if err != nil {
+				fmt.Printf("\033[31mSync to %s (%s) failed:\033[0m %s\n", _ep.TagName, _ep.Location(), err)
+			}
+
+			k.publish(SyncResult{
+				TagName:      _ep.TagName,
+				Location:     _ep.Location(),
+				Files:        changeList.AllFilePathsList(),
+				StartedAt:    startedAt,
+				Duration:     time.Since(startedAt),
+				Copied:       len(modified),
+				Deleted:      len(deleted),
+				CopiedFiles:  k.relPaths(modified),
+				DeletedFiles: k.relPaths(deleted),
+				Bytes:        bytes,
+				Err:          err,
+			})
+
+			countChangedFiles.Add(len(modified) + len(deleted))
 			wg.Done()
-		}(pod)
+		}(pod, changeList)
 	}
 
 	wg.Wait()
@@ -155,33 +345,51 @@ func (k *EndpointSyncker) do(changeList filemon.ChangeList) {
 	}
 }
 
-func (k *EndpointSyncker) syncEndpoint(pod *k8s.Endpoint, changeList filemon.ChangeList, progressCh chan filesystem.TarProcessInfo) (modifiedLen, deletedLen int) {
-	allowedDeletedFiles := getAllowedDeletedFiles(changeList, pod.Artifact.DockerIgnorePredicate)
-	allowedModifiedFiles := getAllowedModifiedFiles(changeList, pod.Artifact.DockerIgnorePredicate)
+// syncEndpoint copies and deletes the allowed files of the change list, onStart is called if there are any
+func (k *EndpointSyncker) syncEndpoint(pod *k8s.Endpoint, changeList filemon.ChangeList, progressCh chan filesystem.TarProcessInfo, onStart func(modifiedLen, deletedLen int)) (modified, deleted []string, bytes int64, err error) {
+	allowedDeletedFiles := getAllowedDeletedFiles(changeList, pod.Artifact.DockerIgnorePredicate())
+	allowedModifiedFiles := getAllowedModifiedFiles(changeList, pod.Artifact.DockerIgnorePredicate())
 
 	allAllowedFiles := append(allowedModifiedFiles, allowedDeletedFiles...)
 
 	allowedDeletedFiles, allowedModifiedFiles = filemon.CheckExistedFiles(allAllowedFiles...)
 
+	// The files excluded by the reloaded ignore rules are deleted while the rules still exclude them
+	allowedDeletedFiles = append(allowedDeletedFiles, getIgnoredFiles(changeList.Excluded(pod.Artifact.Id), pod.Artifact.DockerIgnorePredicate())...)
+
+	allowedDeletedFiles = getMappedFiles(pod.Artifact, allowedDeletedFiles)
+	allowedModifiedFiles = getMappedFiles(pod.Artifact, allowedModifiedFiles)
+
+	// Rebuild triggers are delivered by the image rebuild, not by the sync
+	allowedDeletedFiles = getNotRebuildTriggerFiles(pod.Artifact, allowedDeletedFiles)
+	allowedModifiedFiles = getNotRebuildTriggerFiles(pod.Artifact, allowedModifiedFiles)
+
 	changeFilesCount := len(allowedDeletedFiles) + len(allowedModifiedFiles)
 	if changeFilesCount == 0 {
-		return 0, 0
+		return nil, nil, 0, nil
 	}
 
 	fmt.Printf(
-		"\033[34mSyncing %d files\033[0m \033[37m[\033[0m\033[33m-%d ~%d\033[0m\033[37m]\033[0m \033[37mfor %s\033[0m\n",
+		"\033[34mSyncing %d files\033[0m \033[37m[\033[0m\033[33m-%d ~%d\033[0m\033[37m]\033[0m \033[37mfor %s (%s)\033[0m\n",
 		changeFilesCount,
 		len(allowedDeletedFiles),
 		len(allowedModifiedFiles),
 		pod.TagName,
+		pod.Location(),
 	)
 
+	if onStart != nil {
+		onStart(len(allowedModifiedFiles), len(allowedDeletedFiles))
+	}
+
 	wg := sync.WaitGroup{}
 
+	var deleteErr, copyErr error
+
 	if len(allowedDeletedFiles) > 0 {
 		wg.Add(1)
 		go func() {
-			k.deleteFile(context.Background(), pod, allowedDeletedFiles)
+			deleteErr = k.deleteFile(context.Background(), pod, allowedDeletedFiles)
 			wg.Done()
 		}()
 	}
@@ -189,69 +397,105 @@ func (k *EndpointSyncker) syncEndpoint(pod *k8s.Endpoint, changeList filemon.Cha
 	if len(allowedModifiedFiles) > 0 {
 		wg.Add(1)
 		go func() {
-			k.copyFile(context.Background(), pod, allowedModifiedFiles, progressCh)
+			bytes, copyErr = k.copyFile(context.Background(), pod, allowedModifiedFiles, progressCh)
 			wg.Done()
 		}()
 	}
 
 	wg.Wait()
 
-	return len(allowedModifiedFiles), len(allowedDeletedFiles)
+	err = deleteErr
+	if copyErr != nil {
+		err = copyErr
+	}
+
+	return allowedModifiedFiles, allowedDeletedFiles, bytes, err
 }
 
-func (k *EndpointSyncker) deleteFile(ctx context.Context, pod *k8s.Endpoint, filePaths []string) {
-	args := make([]string, 0, 9+len(filePaths))
-	args = append(args, pod.PodName, "-c", pod.Container, "--", "rm", "-rf", "--")
-	for _, dst := range filePaths {
-		args = append(args, userFilePathToPodFilePath(k.rootDir, pod.Artifact.RootDir, dst, true))
+// relPaths returns the file paths relative to the root dir
+func (k *EndpointSyncker) relPaths(filePaths []string) []string {
+	result := make([]string, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		if relPath, err := filepath.Rel(k.rootDir, filePath); err == nil {
+			filePath = relPath
+		}
+
+		result = append(result, filePath)
 	}
 
-	deleteCmd := k.cli.Command(context.Background(), "exec", args...)
+	return result
+}
+
+// deleteFile removes the files from every sync container of the endpoint
+func (k *EndpointSyncker) deleteFile(ctx context.Context, pod *k8s.Endpoint, filePaths []string) error {
+	podPaths := make([]string, 0, len(filePaths))
+	for _, dst := range filePaths {
+		podPath, ok := userFilePathToPodFilePath(pod.Artifact, dst, true)
+		if !ok {
+			continue
+		}
 
-	stderr := bytes.Buffer{}
-	deleteCmd.Stderr = &stderr
+		podPaths = append(podPaths, podPath)
+	}
 
-	deleteCmd.Run()
-	deleteCmd.Wait()
+	failed := make([]string, 0)
+	for _, container := range pod.SyncContainers {
+		t, err := k.transport(pod, container)
+		if err == nil {
+			err = t.delete(pod, podPaths)
+		}
 
-	if stderr.Len() > 0 {
-		println(stderr.String())
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("container %s: %s", container, err))
+		}
 	}
+
+	return containersError(failed)
 }
 
-func (k *EndpointSyncker) copyFile(ctx context.Context, pod *k8s.Endpoint, filePaths []string, progressCh chan filesystem.TarProcessInfo) {
-	syncFilesMap := localFilePathToSyncMapConverter(k.rootDir, pod.Artifact.RootDir, filePaths)
+// copyFile copies the files to every sync container of the endpoint, returns the bytes written to the containers
+func (k *EndpointSyncker) copyFile(ctx context.Context, pod *k8s.Endpoint, filePaths []string, progressCh chan filesystem.TarProcessInfo) (int64, error) {
+	syncFilesMap := localFilePathToSyncMapConverter(pod.Artifact, filePaths)
+	size := filesSize(syncFilesMap)
+
+	var bytes int64
+	failed := make([]string, 0)
+	for _, container := range pod.SyncContainers {
+		t, err := k.transport(pod, container)
+		if err == nil {
+			err = t.copy(pod, syncFilesMap, progressCh)
+		}
 
-	reader, writer := io.Pipe()
-	go func() {
-		if err := filesystem.CreateMappedTar(writer, "/", syncFilesMap, progressCh); err != nil {
-			writer.CloseWithError(err)
-		} else {
-			writer.Close()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("container %s: %s", container, err))
+			continue
 		}
-	}()
-
-	copyCmd := k.cli.Command(
-		context.Background(),
-		"exec",
-		pod.PodName,
-		"-c",
-		pod.Container, "-i", "--", "tar", "xmf", "-", "-C", "/", "--no-same-owner",
-	)
 
-	copyCmd.Stdin = reader
+		bytes += size
+	}
 
-	stderr := bytes.Buffer{}
-	copyCmd.Stderr = &stderr
+	return bytes, containersError(failed)
+}
 
-	copyCmd.Run()
-	copyCmd.Wait()
+// containersError joins the errors of the containers, nil if none has failed
+func containersError(failed []string) error {
+	if len(failed) == 0 {
+		return nil
+	}
 
-	// fmt.Printf("size: %s", util.LenReadable(0, 2))
+	return errors.New(strings.Join(failed, "; "))
+}
 
-	if stderr.Len() > 0 {
-		println(stderr.String())
+// filesSize sums the sizes of the local files of the sync map
+func filesSize(syncFilesMap map[string]string) int64 {
+	var size int64
+	for localPath := range syncFilesMap {
+		if info, err := os.Stat(localPath); err == nil && !info.IsDir() {
+			size += info.Size()
+		}
 	}
+
+	return size
 }
 
 func getAllowedModifiedFiles(changeList filemon.ChangeList, predicate docker.Predicate) []string {
@@ -284,26 +528,73 @@ func getAllowedDeletedFiles(changeList filemon.ChangeList, predicate docker.Pred
 	return files
 }
 
-func localFilePathToSyncMapConverter(rootDir, podRootPath string, files []string) map[string]string {
+func getIgnoredFiles(filePaths []string, predicate docker.Predicate) []string {
+	files := make([]string, 0, len(filePaths))
+
+	for _, filePath := range filePaths {
+		ok, err := predicate(filePath, nil)
+		if !ok || err != nil {
+			continue
+		}
+
+		files = append(files, filePath)
+	}
+
+	return files
+}
+
+func getMappedFiles(artifact *docker.Artifact, filePaths []string) []string {
+	files := make([]string, 0, len(filePaths))
+
+	for _, filePath := range filePaths {
+		if _, ok := artifact.RemotePath(filePath); !ok {
+			continue
+		}
+
+		files = append(files, filePath)
+	}
+
+	return files
+}
+
+func getNotRebuildTriggerFiles(artifact *docker.Artifact, filePaths []string) []string {
+	files := make([]string, 0, len(filePaths))
+
+	for _, filePath := range filePaths {
+		if artifact.IsRebuildTrigger(filePath) {
+			continue
+		}
+
+		files = append(files, filePath)
+	}
+
+	return files
+}
+
+func localFilePathToSyncMapConverter(artifact *docker.Artifact, files []string) map[string]string {
 	list := make(map[string]string)
 
 	for _, filePath := range files {
-		list[filePath] = userFilePathToPodFilePath(rootDir, podRootPath, filePath, false)
+		podPath, ok := userFilePathToPodFilePath(artifact, filePath, false)
+		if !ok {
+			continue
+		}
+
+		list[filePath] = podPath
 	}
 
 	return list
 }
 
-func userFilePathToPodFilePath(rootDir, podRootPath, userFilePath string, needFirstSlash bool) string {
-	fileRel, err := filepath.Rel(rootDir, userFilePath)
-	if err != nil {
-		return userFilePath
+func userFilePathToPodFilePath(artifact *docker.Artifact, userFilePath string, needFirstSlash bool) (string, bool) {
+	podPath, ok := artifact.RemotePath(userFilePath)
+	if !ok {
+		return "", false
 	}
 
-	podPath := filepath.Join(podRootPath, fileRel)
 	if !needFirstSlash && podPath[0] == '/' {
 		podPath = podPath[1:]
 	}
 
-	return podPath
+	return podPath, true
 }
@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"skasync/pkg/filesystem"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UnroutedTag is the journal tag of the changes that are not yet routed to the endpoints
+const UnroutedTag = ""
+
+// journalSaveDelay batches the writes of the journal, a git checkout brings many change lists at once
+const journalSaveDelay = 500 * time.Millisecond
+
+// Journal keeps the not synced changes on disk, so a restart doesn't lose them.
+// The file paths are stored by the endpoint tag with the time they were last added.
+// The changes are written with journalSaveDelay, Close writes the last ones
+type Journal struct {
+	filePath string
+
+	mu      sync.Mutex
+	pending map[string]map[string]time.Time
+	// saveTimer writes the changed journal, nil when the file is up to date
+	saveTimer *time.Timer
+}
+
+type journalFile struct {
+	Pending map[string]map[string]time.Time `json:"pending"`
+}
+
+func NewJournal(filePath string) *Journal {
+	return &Journal{
+		filePath: filePath,
+		pending:  make(map[string]map[string]time.Time),
+	}
+}
+
+// Load reads the journal left by the previous run, a missing file is an empty journal
+func (j *Journal) Load() error {
+	data, err := os.ReadFile(j.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	f := journalFile{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for tagName, files := range f.Pending {
+		for filePath, t := range files {
+			j.add(tagName, filePath, t)
+		}
+	}
+
+	return nil
+}
+
+// Add records the files as pending for the endpoint
+func (j *Journal) Add(tagName string, files []string) {
+	if len(files) == 0 {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, filePath := range files {
+		j.add(tagName, filePath, now)
+	}
+
+	j.scheduleSave()
+}
+
+// Route moves the unrouted files to the endpoints, routes are the files of every endpoint by the tag.
+// The files no endpoint maps are dropped from the journal
+func (j *Journal) Route(routes map[string][]string, files []string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for tagName, tagFiles := range routes {
+		for _, filePath := range tagFiles {
+			j.add(tagName, filePath, now)
+		}
+	}
+
+	if unrouted, ok := j.pending[UnroutedTag]; ok {
+		for _, filePath := range files {
+			delete(unrouted, filePath)
+		}
+	}
+
+	j.scheduleSave()
+}
+
+// Remove clears the files of the endpoint that were added before the sync had started,
+// the files changed again during the sync stay pending
+func (j *Journal) Remove(tagName string, files []string, syncStartedAt time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	pending, ok := j.pending[tagName]
+	if !ok {
+		return
+	}
+
+	for _, filePath := range files {
+		if t, ok := pending[filePath]; ok && !t.After(syncStartedAt) {
+			delete(pending, filePath)
+		}
+	}
+
+	j.scheduleSave()
+}
+
+// Close writes the changes not written yet
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.saveTimer == nil {
+		return nil
+	}
+
+	j.saveTimer.Stop()
+	j.saveTimer = nil
+
+	return j.save()
+}
+
+// scheduleSave must be called with the lock held, the changes made meanwhile are written together
+func (j *Journal) scheduleSave() {
+	if j.saveTimer != nil {
+		return
+	}
+
+	j.saveTimer = time.AfterFunc(journalSaveDelay, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		// Close has written the changes already
+		if j.saveTimer == nil {
+			return
+		}
+		j.saveTimer = nil
+
+		if err := j.save(); err != nil {
+			fmt.Printf("\033[31mJournal write failed:\033[0m %s\n", err)
+		}
+	})
+}
+
+// Pending returns the pending files by the endpoint tag
+func (j *Journal) Pending() map[string][]string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	result := make(map[string][]string, len(j.pending))
+	for tagName, files := range j.pending {
+		list := make([]string, 0, len(files))
+		for filePath := range files {
+			list = append(list, filePath)
+		}
+		sort.Strings(list)
+
+		result[tagName] = list
+	}
+
+	return result
+}
+
+// add must be called with the lock held, the latest time of the file wins
+func (j *Journal) add(tagName, filePath string, t time.Time) {
+	files, ok := j.pending[tagName]
+	if !ok {
+		files = make(map[string]time.Time)
+		j.pending[tagName] = files
+	}
+
+	if prev, ok := files[filePath]; ok && prev.After(t) {
+		return
+	}
+
+	files[filePath] = t
+}
+
+// save must be called with the lock held. The file is replaced atomically, the empty journal is removed
+func (j *Journal) save() error {
+	for tagName, files := range j.pending {
+		if len(files) == 0 {
+			delete(j.pending, tagName)
+		}
+	}
+
+	if len(j.pending) == 0 {
+		if err := os.Remove(j.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if err := filesystem.MkdirPrivate(filepath.Dir(j.filePath)); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(journalFile{Pending: j.pending})
+	if err != nil {
+		return err
+	}
+
+	tmpPath := j.filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, j.filePath)
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJournalCloseAndLoad(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), ".skasync", "journal.json")
+
+	j := NewJournal(filePath)
+	j.Add("app", []string{"/src/b.php", "/src/a.php"})
+	j.Add(UnroutedTag, []string{"/src/c.php"})
+
+	// The writes are batched, Close writes them at once
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("journal is written before the save delay: %v", err)
+	}
+
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewJournal(filePath)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"app":       {"/src/a.php", "/src/b.php"},
+		UnroutedTag: {"/src/c.php"},
+	}
+	if got := loaded.Pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+}
+
+func TestJournalSavesAfterDelay(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "journal.json")
+
+	j := NewJournal(filePath)
+	j.Add("app", []string{"/src/a.php"})
+
+	deadline := time.Now().Add(10 * journalSaveDelay)
+	for {
+		if _, err := os.Stat(filePath); err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("journal is not written after the save delay")
+		}
+
+		time.Sleep(journalSaveDelay / 10)
+	}
+
+	// Nothing is left for Close
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalRemoveKeepsFilesChangedDuringSync(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "journal.json")
+
+	j := NewJournal(filePath)
+	j.Add("app", []string{"/src/a.php", "/src/b.php"})
+
+	syncStartedAt := time.Now()
+	time.Sleep(time.Millisecond)
+	j.Add("app", []string{"/src/b.php"})
+
+	j.Remove("app", []string{"/src/a.php", "/src/b.php"}, syncStartedAt)
+	j.Remove("other", []string{"/src/a.php"}, syncStartedAt)
+
+	want := map[string][]string{"app": {"/src/b.php"}}
+	if got := j.Pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+
+	// The empty journal is removed
+	j.Remove("app", []string{"/src/b.php"}, time.Now())
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("empty journal file is kept: %v", err)
+	}
+}
+
+func TestJournalRoute(t *testing.T) {
+	j := NewJournal(filepath.Join(t.TempDir(), "journal.json"))
+	j.Add(UnroutedTag, []string{"/src/a.php", "/docs/readme.md", "/other.txt"})
+
+	// readme.md is mapped by no endpoint and dropped, other.txt is not routed yet
+	j.Route(map[string][]string{
+		"app":    {"/src/a.php"},
+		"worker": {"/src/a.php"},
+	}, []string{"/src/a.php", "/docs/readme.md"})
+
+	want := map[string][]string{
+		"app":       {"/src/a.php"},
+		"worker":    {"/src/a.php"},
+		UnroutedTag: {"/other.txt"},
+	}
+	if got := j.Pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending() = %v, want %v", got, want)
+	}
+
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
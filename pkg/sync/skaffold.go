@@ -3,28 +3,57 @@ package sync
 import (
 	"context"
 	"fmt"
+	"skasync/pkg/docker"
+	"skasync/pkg/filemon"
 	"skasync/pkg/k8s"
 	"skasync/pkg/skaffold"
 	"sync"
+	"time"
 )
 
+// rebuildStartTimeout is how long the requested rebuild may take to show up in the skaffold status
+const rebuildStartTimeout = 30 * time.Second
+
+// resyncDelay is how long the endpoint whose sync has failed waits for the retry
+const resyncDelay = 5 * time.Second
+
+// SkaffoldStatusLayer gates the change lists of every gateway provider by the skaffold deploy
+// state. The changes are buffered per endpoint while the artifact of the endpoint is deployed
+// or the endpoint has no pod, the other endpoints keep syncing
 type SkaffoldStatusLayer struct {
-	isWatching       bool
-	outChangeFilesCh chan []string
+	isWatching     bool
+	outChangeMapCh chan EndpointChangeMap
 
 	podCtrl *k8s.EndpointCtrl
+	client  skaffold.APIClient
+	journal *Journal
 
-	mu                sync.Mutex
-	lastStatus        skaffold.SkaffoldProcessStatus
-	changeFilesBuffer map[string]struct{}
+	mu         sync.Mutex
+	lastStatus skaffold.SkaffoldProcessStatus
+	// buffers are the change lists of the not ready endpoints by the endpoint tag
+	buffers map[string]filemon.ChangeList
+	// isPaused and pausedTags hold the changes of all endpoints or the listed ones in the buffers, see Pause
+	isPaused   bool
+	pausedTags map[string]struct{}
+
+	// awaitingRebuild are the artifact ids from the rebuild request until skaffold reports them not ready
+	awaitingRebuild map[string]struct{}
+	rebuildTimer    *time.Timer
+	// requeued are the endpoint tags waiting for the retry of the failed sync, see Requeue
+	requeued map[string]struct{}
 }
 
-func NewSkaffoldStatusLayer(isWatching bool, outChangeFilesCh chan []string, podCtrl *k8s.EndpointCtrl) *SkaffoldStatusLayer {
+func NewSkaffoldStatusLayer(isWatching bool, outChangeMapCh chan EndpointChangeMap, podCtrl *k8s.EndpointCtrl, client skaffold.APIClient, journal *Journal) *SkaffoldStatusLayer {
 	return &SkaffoldStatusLayer{
-		isWatching:        isWatching,
-		podCtrl:           podCtrl,
-		outChangeFilesCh:  outChangeFilesCh,
-		changeFilesBuffer: make(map[string]struct{}),
+		isWatching:      isWatching,
+		podCtrl:         podCtrl,
+		client:          client,
+		journal:         journal,
+		outChangeMapCh:  outChangeMapCh,
+		buffers:         make(map[string]filemon.ChangeList),
+		pausedTags:      make(map[string]struct{}),
+		awaitingRebuild: make(map[string]struct{}),
+		requeued:        make(map[string]struct{}),
 	}
 }
 
@@ -34,76 +63,546 @@ func (ssl *SkaffoldStatusLayer) StatusHandler(status skaffold.SkaffoldProcessSta
 	}
 
 	ssl.mu.Lock()
-	defer ssl.mu.Unlock()
 
 	if ssl.lastStatus.IsReady && !status.IsReady {
 		println("Skaffold deploy is down")
 	}
 
-	if !ssl.lastStatus.IsReady && status.IsReady {
-		println("Skaffold deploy is up")
-		err := ssl.podCtrl.Refresh()
-		if err != nil {
-			panic(err)
+	becameReady := make([]string, 0)
+	for image, isReady := range status.ReadyArtifacts {
+		if isReady && !ssl.lastStatus.IsArtifactReady(image) {
+			becameReady = append(becameReady, image)
 		}
+	}
 
-		println("Watching for changes...")
-
-		if ssl.bufferCount() > 0 {
-			fmt.Printf("Sync change files from buffer (%d)\n", ssl.bufferCount())
-
-			ssl.outChangeFilesCh <- ssl.getChangeFilesBuffer()
-			ssl.cleanBuffer()
+	for _, ep := range ssl.podCtrl.GetPods() {
+		if _, ok := ssl.awaitingRebuild[ep.Artifact.Id]; ok && !status.IsArtifactReady(ep.Artifact.Image) {
+			ssl.stopAwaitingRebuild(ep.Artifact.Id)
 		}
 	}
 
+	if !ssl.lastStatus.IsReady && status.IsReady {
+		println("Skaffold deploy is up")
+	}
+
 	ssl.lastStatus = status
+
+	if len(becameReady) == 0 {
+		ssl.mu.Unlock()
+		return
+	}
+
+	fmt.Printf("Skaffold artifacts are deployed: %v\n", becameReady)
+
+	// The recreated pods of the redeployed artifacts are bound by the endpoint watches
+	out := ssl.flush()
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+
+	println("Watching for changes...")
 }
 
-func (ssl *SkaffoldStatusLayer) Do(ctx context.Context, inChangeFilesCh chan []string) error {
+func (ssl *SkaffoldStatusLayer) Do(ctx context.Context, inChangeListCh chan filemon.ChangeList) error {
 	for {
 		select {
-		case changeFiles := <-inChangeFilesCh:
-			if !ssl.isWatching || ssl.lastStatus.IsReady {
-				ssl.outChangeFilesCh <- changeFiles
-				break
+		case changeList := <-inChangeListCh:
+			if triggers := ssl.getRebuildTriggers(changeList.AllFilePathsList()); len(triggers) > 0 {
+				ssl.requestRebuild(ctx, triggers)
 			}
 
+			ssl.route(changeList.AllFilePathsList())
+
 			ssl.mu.Lock()
-			ssl.appendToBuffer(changeFiles)
-			ssl.mu.Unlock()
+			out := make(EndpointChangeMap)
 
-			if ssl.lastStatus.DoesNotAnswer {
-				fmt.Printf("Skaffold is down, awaiting start... (%d) files in buffer\n", len(ssl.changeFilesBuffer))
-			} else if !ssl.lastStatus.IsReady {
-				fmt.Printf("Awaiting deploy... (%d) files in buffer\n", len(ssl.changeFilesBuffer))
+			for _, tagName := range ssl.podCtrl.Tags() {
+				// The changes of the endpoint without a pod wait for the pod
+				if ep, err := ssl.podCtrl.FindByTag(tagName); err == nil && ssl.isEndpointReady(ep) {
+					out[tagName] = changeList
+					continue
+				}
+
+				ssl.appendToBuffer(tagName, changeList)
 			}
+
+			ssl.printBufferState()
+			ssl.mu.Unlock()
+
+			ssl.send(out)
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
-func (ssl *SkaffoldStatusLayer) appendToBuffer(files []string) {
-	for _, filePath := range files {
-		ssl.changeFilesBuffer[filePath] = struct{}{}
+// EndpointHandler syncs the buffered changes to the endpoint that has got a new pod
+func (ssl *SkaffoldStatusLayer) EndpointHandler(e k8s.EndpointEvent) {
+	if e.IsRemoved {
+		ssl.drop(e.TagName)
+		return
+	}
+
+	if len(e.PodName) == 0 {
+		fmt.Printf("\033[33mEndpoint %s (%s/%s) is waiting, the changes are queued:\033[0m %s\n", e.TagName, e.Context, e.Namespace, e.Reason)
+		return
+	}
+
+	fmt.Printf("Endpoint %s is bound to pod %s/%s/%s\n", e.TagName, e.Context, e.Namespace, e.PodName)
+
+	ssl.mu.Lock()
+	out := ssl.flush()
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+}
+
+// Status returns the last skaffold status, isWatching is false if the deploy status is not watched
+func (ssl *SkaffoldStatusLayer) Status() (isWatching bool, status skaffold.SkaffoldProcessStatus) {
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	return ssl.isWatching, ssl.lastStatus
+}
+
+// Buffered returns the count of the queued files by the endpoint tag
+func (ssl *SkaffoldStatusLayer) Buffered() map[string]int {
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	buffered := make(map[string]int, len(ssl.buffers))
+	for tagName, changeList := range ssl.buffers {
+		buffered[tagName] = changeList.CountAll()
+	}
+
+	return buffered
+}
+
+// Pause buffers the changes of the endpoint until Resume, all endpoints are paused if the tag is empty
+func (ssl *SkaffoldStatusLayer) Pause(tagName string) error {
+	if err := ssl.checkTag(tagName); err != nil {
+		return err
+	}
+
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	if len(tagName) == 0 {
+		ssl.isPaused = true
+		println("Syncing is paused, the changes are queued")
+		return nil
+	}
+
+	ssl.pausedTags[tagName] = struct{}{}
+	fmt.Printf("Syncing to %s is paused, the changes are queued\n", tagName)
+
+	return nil
+}
+
+// Resume syncs the changes buffered while the endpoint was paused, all endpoints are resumed
+// if the tag is empty. The endpoint paused by its tag is still paused after the global resume
+func (ssl *SkaffoldStatusLayer) Resume(tagName string) error {
+	if err := ssl.checkTag(tagName); err != nil {
+		return err
+	}
+
+	ssl.mu.Lock()
+
+	if len(tagName) == 0 {
+		ssl.isPaused = false
+		println("Syncing is resumed")
+	} else {
+		delete(ssl.pausedTags, tagName)
+		fmt.Printf("Syncing to %s is resumed\n", tagName)
+	}
+
+	out := ssl.flush()
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+
+	return nil
+}
+
+// Paused reports whether all endpoints are paused and the endpoints paused by the tag
+func (ssl *SkaffoldStatusLayer) Paused() (isPaused bool, tags map[string]bool) {
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	tags = make(map[string]bool, len(ssl.pausedTags))
+	for tagName := range ssl.pausedTags {
+		tags[tagName] = true
 	}
+
+	return ssl.isPaused, tags
 }
 
-func (ssl *SkaffoldStatusLayer) getChangeFilesBuffer() []string {
-	buf := make([]string, 0, len(ssl.changeFilesBuffer))
+// Flush syncs the buffers of the endpoints with a pod right away, despite the pause and the skaffold
+// deploy. It returns the count of the flushed files by the endpoint tag
+func (ssl *SkaffoldStatusLayer) Flush() map[string]int {
+	ssl.mu.Lock()
+
+	flushed := make(map[string]int)
+	out := make(EndpointChangeMap)
+
+	for _, ep := range ssl.podCtrl.GetPods() {
+		changeList, ok := ssl.buffers[ep.TagName]
+		if !ok {
+			continue
+		}
+
+		fmt.Printf("Flush change files from buffer (%d) for %s\n", changeList.CountAll(), ep.TagName)
+
+		flushed[ep.TagName] = changeList.CountAll()
+		out[ep.TagName] = changeList
+		delete(ssl.buffers, ep.TagName)
+	}
 
-	for filePath := range ssl.changeFilesBuffer {
-		buf = append(buf, filePath)
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+
+	return flushed
+}
+
+// checkTag returns the error if the endpoint is unknown, the empty tag stands for all endpoints
+func (ssl *SkaffoldStatusLayer) checkTag(tagName string) error {
+	if len(tagName) == 0 {
+		return nil
+	}
+
+	for _, tag := range ssl.podCtrl.Tags() {
+		if tag == tagName {
+			return nil
+		}
 	}
 
-	return buf
+	return fmt.Errorf("endpoint %s not found", tagName)
 }
 
-func (ssl *SkaffoldStatusLayer) bufferCount() int {
-	return len(ssl.changeFilesBuffer)
+// drop forgets the buffered changes of the endpoint removed from the config
+func (ssl *SkaffoldStatusLayer) drop(tagName string) {
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	buffer, ok := ssl.buffers[tagName]
+	delete(ssl.buffers, tagName)
+	delete(ssl.pausedTags, tagName)
+
+	if !ok || len(buffer.AllFilePathsList()) == 0 {
+		fmt.Printf("Endpoint %s is removed\n", tagName)
+		return
+	}
+
+	files := buffer.AllFilePathsList()
+	fmt.Printf("Endpoint %s is removed, drop %d queued files\n", tagName, len(files))
+
+	if ssl.journal == nil {
+		return
+	}
+
+	ssl.journal.Remove(tagName, files, time.Now())
 }
 
-func (ssl *SkaffoldStatusLayer) cleanBuffer() {
-	ssl.changeFilesBuffer = make(map[string]struct{})
+// Restore buffers the changes left by the previous run, they are synced once the endpoints are ready.
+// The changes of the endpoints that are not configured anymore are dropped
+func (ssl *SkaffoldStatusLayer) Restore(pending map[string][]string) {
+	if ssl.journal == nil {
+		return
+	}
+
+	routes := ssl.route(pending[UnroutedTag])
+
+	ssl.mu.Lock()
+
+	restored := 0
+	for _, tagName := range ssl.podCtrl.Tags() {
+		files := append(pending[tagName], routes[tagName]...)
+		delete(pending, tagName)
+
+		if len(files) == 0 {
+			continue
+		}
+
+		ssl.appendToBuffer(tagName, filemon.ChangeFilesToChangeListConverter(files))
+		restored += len(files)
+	}
+
+	delete(pending, UnroutedTag)
+	for tagName, files := range pending {
+		fmt.Printf("Drop %d journal files of unknown endpoint %s\n", len(files), tagName)
+
+		ssl.journal.Remove(tagName, files, time.Now())
+	}
+
+	if restored > 0 {
+		fmt.Printf("Restored %d not synced files from journal\n", restored)
+	}
+
+	var out EndpointChangeMap
+	if restored > 0 && !ssl.isWatching {
+		out = ssl.flush()
+	}
+
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+}
+
+// route moves the files from the unrouted journal entry to the endpoints whose artifact mappings match
+// them, returns the files by the endpoint tag
+func (ssl *SkaffoldStatusLayer) route(files []string) map[string][]string {
+	routes := make(map[string][]string)
+	if ssl.journal == nil || len(files) == 0 {
+		return routes
+	}
+
+	for tagName, artifact := range ssl.podCtrl.Artifacts() {
+		if mapped := getMappedFiles(artifact, files); len(mapped) > 0 {
+			routes[tagName] = mapped
+		}
+	}
+
+	ssl.journal.Route(routes, files)
+
+	return routes
+}
+
+// Requeue syncs the journal files of the endpoint again after resyncDelay, its sync has failed.
+// The failures meanwhile are retried together
+func (ssl *SkaffoldStatusLayer) Requeue(tagName string) {
+	if ssl.journal == nil {
+		return
+	}
+
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	if _, ok := ssl.requeued[tagName]; ok {
+		return
+	}
+	ssl.requeued[tagName] = struct{}{}
+
+	time.AfterFunc(resyncDelay, func() {
+		files := ssl.journal.Pending()[tagName]
+
+		ssl.mu.Lock()
+		delete(ssl.requeued, tagName)
+
+		if len(files) == 0 {
+			ssl.mu.Unlock()
+			return
+		}
+
+		fmt.Printf("Retry the sync of %d journal files for %s\n", len(files), tagName)
+
+		out := make(EndpointChangeMap)
+		changeList := filemon.ChangeFilesToChangeListConverter(files)
+		if ep, err := ssl.podCtrl.FindByTag(tagName); err == nil && ssl.isEndpointReady(ep) {
+			out[tagName] = changeList
+		} else {
+			ssl.appendToBuffer(tagName, changeList)
+		}
+		ssl.mu.Unlock()
+
+		ssl.send(out)
+	})
+}
+
+// isEndpointReady must be called with the lock held
+func (ssl *SkaffoldStatusLayer) isEndpointReady(ep *k8s.Endpoint) bool {
+	if ssl.isEndpointPaused(ep.TagName) {
+		return false
+	}
+
+	if !ssl.isWatching {
+		return true
+	}
+
+	if _, ok := ssl.awaitingRebuild[ep.Artifact.Id]; ok {
+		return false
+	}
+
+	return ssl.lastStatus.IsArtifactReady(ep.Artifact.Image)
+}
+
+// isEndpointPaused must be called with the lock held
+func (ssl *SkaffoldStatusLayer) isEndpointPaused(tagName string) bool {
+	if ssl.isPaused {
+		return true
+	}
+
+	_, ok := ssl.pausedTags[tagName]
+
+	return ok
+}
+
+// getRebuildTriggers returns the files that can't be synced and the ids of the artifacts they require to rebuild
+func (ssl *SkaffoldStatusLayer) getRebuildTriggers(files []string) map[string][]string {
+	artifacts := make(map[*docker.Artifact]struct{})
+	for _, ep := range ssl.podCtrl.GetPods() {
+		if ep.Artifact != nil {
+			artifacts[ep.Artifact] = struct{}{}
+		}
+	}
+
+	triggers := make(map[string][]string)
+	for artifact := range artifacts {
+		for _, filePath := range files {
+			if artifact.IsRebuildTrigger(filePath) {
+				triggers[artifact.Id] = append(triggers[artifact.Id], filePath)
+			}
+		}
+	}
+
+	return triggers
+}
+
+// requestRebuild asks skaffold to rebuild and redeploy, the changes of the rebuilt artifacts are
+// buffered until the new deploy is ready
+func (ssl *SkaffoldStatusLayer) requestRebuild(ctx context.Context, triggers map[string][]string) {
+	if !ssl.isWatching {
+		for id, files := range triggers {
+			fmt.Printf("\033[33mRebuild of %s is required, %d files are not synced:\033[0m %v\n", id, len(files), files)
+		}
+		return
+	}
+
+	ssl.mu.Lock()
+	defer ssl.mu.Unlock()
+
+	// The ids are awaited before the request is sent, the status of the started build may come
+	// before skaffold answers
+	ids := make([]string, 0, len(triggers))
+	for id := range triggers {
+		if _, ok := ssl.awaitingRebuild[id]; ok {
+			continue
+		}
+
+		ssl.awaitingRebuild[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	if ssl.rebuildTimer != nil {
+		ssl.rebuildTimer.Stop()
+	}
+	ssl.rebuildTimer = time.AfterFunc(rebuildStartTimeout, ssl.rebuildTimeout)
+
+	fmt.Printf("\033[33mRequesting rebuild of %v, the changed files can't be synced\033[0m\n", ids)
+
+	// The Do loop keeps syncing the other endpoints while skaffold answers
+	go func() {
+		if err := ssl.client.Execute(ctx, skaffold.Intent{Build: true, Deploy: true}); err != nil {
+			fmt.Printf("\033[31mSkaffold rebuild request failed:\033[0m %s\n", err)
+			ssl.cancelRebuild(ids)
+		}
+	}()
+}
+
+// cancelRebuild stops awaiting the artifacts of the failed request and releases their buffers
+func (ssl *SkaffoldStatusLayer) cancelRebuild(ids []string) {
+	ssl.mu.Lock()
+
+	for _, id := range ids {
+		ssl.stopAwaitingRebuild(id)
+	}
+
+	out := ssl.flush()
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+}
+
+// rebuildTimeout releases the buffers if skaffold didn't start the requested rebuild
+func (ssl *SkaffoldStatusLayer) rebuildTimeout() {
+	ssl.mu.Lock()
+
+	if len(ssl.awaitingRebuild) == 0 {
+		ssl.mu.Unlock()
+		return
+	}
+
+	println("Skaffold didn't start the rebuild")
+
+	for id := range ssl.awaitingRebuild {
+		ssl.stopAwaitingRebuild(id)
+	}
+
+	out := ssl.flush()
+	ssl.mu.Unlock()
+
+	ssl.send(out)
+}
+
+// stopAwaitingRebuild must be called with the lock held
+func (ssl *SkaffoldStatusLayer) stopAwaitingRebuild(artifactId string) {
+	delete(ssl.awaitingRebuild, artifactId)
+
+	if len(ssl.awaitingRebuild) == 0 && ssl.rebuildTimer != nil {
+		ssl.rebuildTimer.Stop()
+		ssl.rebuildTimer = nil
+	}
+}
+
+// flush takes the buffers of the ready endpoints out, must be called with the lock held.
+// The result is sent by send after the lock is released, the syncer may wait for the lock meanwhile
+func (ssl *SkaffoldStatusLayer) flush() EndpointChangeMap {
+	out := make(EndpointChangeMap)
+
+	for _, ep := range ssl.podCtrl.GetPods() {
+		changeList, ok := ssl.buffers[ep.TagName]
+		if !ok || !ssl.isEndpointReady(ep) {
+			continue
+		}
+
+		fmt.Printf("Sync change files from buffer (%d) for %s\n", changeList.CountAll(), ep.TagName)
+
+		out[ep.TagName] = changeList
+		delete(ssl.buffers, ep.TagName)
+	}
+
+	return out
+}
+
+// send passes the changes on to the syncer, must be called without the lock
+func (ssl *SkaffoldStatusLayer) send(out EndpointChangeMap) {
+	if len(out) > 0 {
+		ssl.outChangeMapCh <- out
+	}
+}
+
+// printBufferState must be called with the lock held
+func (ssl *SkaffoldStatusLayer) printBufferState() {
+	for tagName, changeList := range ssl.buffers {
+		_, err := ssl.podCtrl.FindByTag(tagName)
+
+		switch {
+		case err != nil:
+			fmt.Printf("Awaiting pod... (%d) files in buffer for %s\n", changeList.CountAll(), tagName)
+		case ssl.isEndpointPaused(tagName):
+			fmt.Printf("Paused... (%d) files in buffer for %s\n", changeList.CountAll(), tagName)
+		case !ssl.isWatching:
+			continue
+		case ssl.lastStatus.DoesNotAnswer:
+			fmt.Printf("Skaffold is down, awaiting start... (%d) files in buffer for %s\n", changeList.CountAll(), tagName)
+		case len(ssl.awaitingRebuild) > 0:
+			fmt.Printf("Awaiting rebuild... (%d) files in buffer for %s\n", changeList.CountAll(), tagName)
+		default:
+			fmt.Printf("Awaiting deploy... (%d) files in buffer for %s\n", changeList.CountAll(), tagName)
+		}
+	}
+}
+
+// appendToBuffer must be called with the lock held. The change list is copied, the lists share the maps
+func (ssl *SkaffoldStatusLayer) appendToBuffer(tagName string, changeList filemon.ChangeList) {
+	buffer, ok := ssl.buffers[tagName]
+	if !ok {
+		buffer = filemon.NewChangeList()
+	}
+
+	ssl.buffers[tagName] = buffer.Union(changeList)
 }
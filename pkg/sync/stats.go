@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats keeps the last sync of every endpoint and the counters of the watcher, see the status API
+type Stats struct {
+	startedAt time.Time
+
+	mu           sync.Mutex
+	lastSyncs    map[string]SyncResult
+	changeLists  int
+	lastChangeAt time.Time
+	syncs        int
+	failedSyncs  int
+}
+
+// StatsSnapshot is the copy of the stats at the moment, the zero time means there was nothing yet
+type StatsSnapshot struct {
+	StartedAt,
+	LastChangeAt time.Time
+	ChangeLists,
+	Syncs,
+	FailedSyncs int
+	LastSyncs map[string]SyncResult
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		startedAt: time.Now(),
+		lastSyncs: make(map[string]SyncResult),
+	}
+}
+
+// AddChangeList counts the change list collected by the gateway
+func (s *Stats) AddChangeList() {
+	s.mu.Lock()
+	s.changeLists++
+	s.lastChangeAt = time.Now()
+	s.mu.Unlock()
+}
+
+// AddSyncResult keeps the result as the last sync of the endpoint, the syncs of nothing are skipped
+func (s *Stats) AddSyncResult(result SyncResult) {
+	if result.Copied+result.Deleted == 0 && result.Err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.lastSyncs[result.TagName] = result
+	s.syncs++
+	if result.Err != nil {
+		s.failedSyncs++
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastSyncs := make(map[string]SyncResult, len(s.lastSyncs))
+	for tagName, result := range s.lastSyncs {
+		lastSyncs[tagName] = result
+	}
+
+	return StatsSnapshot{
+		StartedAt:    s.startedAt,
+		LastChangeAt: s.lastChangeAt,
+		ChangeLists:  s.changeLists,
+		Syncs:        s.syncs,
+		FailedSyncs:  s.failedSyncs,
+		LastSyncs:    lastSyncs,
+	}
+}
@@ -0,0 +1,340 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"skasync/pkg/cli"
+	"skasync/pkg/filesystem"
+	"skasync/pkg/k8s"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// transportTar writes the files with tar and rm of the container
+	transportTar = "tar"
+	// transportShell streams every file through sh and cat of the container, used when there is no tar
+	transportShell = "shell"
+	// transportDebug writes the files with tar and rm of the ephemeral debug container
+	transportDebug = "debug"
+)
+
+// debugContainerStartTimeout is how long the attached debug container may take to start
+const debugContainerStartTimeout = 30 * time.Second
+
+// transport is the way to write the files to the container
+type transport struct {
+	kind string
+	// container runs the commands, it is the debug container for transportDebug
+	container string
+	// root is the path of the target container filesystem in container
+	root string
+}
+
+// errToolMissing is returned by the probe of the command the container has not
+var errToolMissing = errors.New("command is not found in the container")
+
+// transport returns the detected transport of the endpoint container, the detection is done once per pod.
+// The failed detection is not kept, it is retried by the next sync
+func (k *EndpointSyncker) transport(pod *k8s.Endpoint, container string) (transport, error) {
+	key := pod.Location() + "/" + container
+
+	k.mu.Lock()
+	probeMu, ok := k.probeLocks[key]
+	if !ok {
+		probeMu = &sync.Mutex{}
+		k.probeLocks[key] = probeMu
+	}
+	k.mu.Unlock()
+
+	probeMu.Lock()
+	defer probeMu.Unlock()
+
+	k.mu.Lock()
+	t, ok := k.transports[key]
+	k.mu.Unlock()
+
+	if ok {
+		return t, nil
+	}
+
+	t, err := k.detectTransport(pod, container)
+	if err != nil {
+		return t, err
+	}
+
+	k.mu.Lock()
+	k.transports[key] = t
+	k.mu.Unlock()
+
+	return t, nil
+}
+
+func (k *EndpointSyncker) detectTransport(pod *k8s.Endpoint, container string) (transport, error) {
+	// Busybox tar has no --version, the archive of nothing works for both GNU and busybox tar
+	err := execProbe(pod, container, "tar", "-cf", "/dev/null", "/dev/null")
+	if err == nil {
+		return transport{kind: transportTar, container: container, root: "/"}, nil
+	}
+	if !errors.Is(err, errToolMissing) {
+		return transport{}, err
+	}
+
+	// The missing tool exits like the missing sh, with 127
+	err = execProbe(pod, container, "sh", "-c", "command -v cat && command -v mkdir && command -v rm || exit 127")
+	if err == nil {
+		fmt.Printf("\033[33mContainer %s of %s has no tar, the files are streamed through sh\033[0m\n", container, pod.Location())
+		return transport{kind: transportShell, container: container, root: "/"}, nil
+	}
+	if !errors.Is(err, errToolMissing) {
+		return transport{}, err
+	}
+
+	if !k.debugCfg.Enabled {
+		return transport{}, errors.New("the container has no tar or sh, enable Sync.DebugContainer")
+	}
+
+	debugContainer, err := attachDebugContainer(pod, container, k.debugCfg.Image)
+	if err != nil {
+		return transport{}, err
+	}
+
+	pid, err := k.targetPid(pod, container, debugContainer)
+	if err != nil {
+		return transport{}, err
+	}
+
+	return transport{kind: transportDebug, container: debugContainer, root: "/proc/" + pid + "/root"}, nil
+}
+
+// targetPid finds the process of the target container seen by the debug container, its root is the
+// target filesystem. The process is matched by the container id in its cgroup, the pod sharing the
+// process namespace has the pause container as the pid 1
+func (k *EndpointSyncker) targetPid(pod *k8s.Endpoint, container, debugContainer string) (string, error) {
+	var target *cli.Pod
+	for _, p := range k.podsCtrl.Pods(pod.TagName) {
+		if p.Metadata.Name == pod.PodName {
+			p := p
+			target = &p
+			break
+		}
+	}
+	if target == nil {
+		return "", fmt.Errorf("pod %s is not watched anymore", pod.PodName)
+	}
+
+	containerId := ""
+	for _, status := range target.Status.ContainerStatuses {
+		if status.Name == container {
+			if i := strings.Index(status.ContainerID, "://"); i >= 0 {
+				containerId = status.ContainerID[i+3:]
+			}
+		}
+	}
+
+	if len(containerId) > 0 {
+		const script = `for p in /proc/[0-9]*; do grep -qF "$1" "$p/cgroup" 2>/dev/null && echo "${p#/proc/}" && exit 0; done; exit 1`
+
+		cmd := pod.CLI.Command(context.Background(), "exec", pod.PodName, "-c", debugContainer, "--", "sh", "-c", script, "sh", containerId)
+		if out, err := cmd.Output(); err == nil && len(bytes.TrimSpace(out)) > 0 {
+			return string(bytes.TrimSpace(out)), nil
+		}
+	}
+
+	// The process namespace of the target only, its main process is the pid 1
+	if !target.Spec.ShareProcessNamespace {
+		return "1", nil
+	}
+
+	return "", fmt.Errorf("process of container %s is not found in debug container %s", container, debugContainer)
+}
+
+// attachDebugContainer attaches the ephemeral container targeting the container, the one attached
+// by the previous run is reused
+func attachDebugContainer(pod *k8s.Endpoint, container, image string) (string, error) {
+	name := "skasync-" + container
+	if len(name) > 63 {
+		name = name[:63]
+	}
+
+	if execProbe(pod, name, "true") == nil {
+		return name, nil
+	}
+
+	fmt.Printf("\033[33mContainer %s of %s has no tar or sh, attaching debug container %s (%s)\033[0m\n", container, pod.Location(), name, image)
+
+	cmd := pod.CLI.Command(
+		context.Background(),
+		"debug",
+		pod.PodName,
+		"-c", name,
+		"--target", container,
+		"--image", image,
+		"--", "sleep", "2147483647",
+	)
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("kubectl debug: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	deadline := time.Now().Add(debugContainerStartTimeout)
+	for {
+		err := execProbe(pod, name, "true")
+		if err == nil {
+			return name, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("debug container %s didn't start: %w", name, err)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// execProbe runs the command in the container. The errToolMissing is returned if the container has
+// no such command, by the exit codes 126 and 127 of the shell or "not found" of the runtime. The other
+// errors are of kubectl or the pod, they say nothing about the container tools
+func execProbe(pod *k8s.Endpoint, container string, command ...string) error {
+	args := append([]string{pod.PodName, "-c", container, "--"}, command...)
+
+	cmd := pod.CLI.Command(context.Background(), "exec", args...)
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) && (exitErr.ExitCode() == 126 || exitErr.ExitCode() == 127) {
+		return errToolMissing
+	}
+
+	if isNotFoundOutput(stderr.Bytes()) {
+		return errToolMissing
+	}
+
+	return fmt.Errorf("kubectl exec %s: %w: %s", command[0], err, bytes.TrimSpace(stderr.Bytes()))
+}
+
+// isNotFoundOutput is true for the runtime error of the missing executable
+func isNotFoundOutput(stderr []byte) bool {
+	out := strings.ToLower(string(stderr))
+
+	// "pods ... not found" of kubectl has no colon before it
+	return strings.Contains(out, "executable file not found") || strings.Contains(out, ": not found")
+}
+
+// delete removes the container paths
+func (t transport) delete(pod *k8s.Endpoint, podPaths []string) error {
+	args := make([]string, 0, 7+len(podPaths))
+	args = append(args, pod.PodName, "-c", t.container, "--", "rm", "-rf", "--")
+	for _, podPath := range podPaths {
+		args = append(args, path.Join(t.root, podPath))
+	}
+
+	deleteCmd := pod.CLI.Command(context.Background(), "exec", args...)
+
+	stderr := bytes.Buffer{}
+	deleteCmd.Stderr = &stderr
+
+	err := deleteCmd.Run()
+
+	if stderr.Len() > 0 {
+		println(stderr.String())
+	}
+
+	return err
+}
+
+// copy writes the local files to the container paths of the sync map
+func (t transport) copy(pod *k8s.Endpoint, syncFilesMap map[string]string, progressCh chan filesystem.TarProcessInfo) error {
+	if t.kind == transportShell {
+		return t.copyThroughShell(pod, syncFilesMap)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		if err := filesystem.CreateMappedTar(writer, "/", syncFilesMap, progressCh); err != nil {
+			writer.CloseWithError(err)
+		} else {
+			writer.Close()
+		}
+	}()
+
+	args := []string{pod.PodName, "-c", t.container, "-i", "--", "tar", "xmf", "-", "-C", "/", "--no-same-owner"}
+	if t.kind == transportDebug {
+		// The short flags are understood by busybox tar as well
+		args = []string{pod.PodName, "-c", t.container, "-i", "--", "tar", "-x", "-m", "-o", "-f", "-", "-C", t.root}
+	}
+
+	copyCmd := pod.CLI.Command(context.Background(), "exec", args...)
+
+	copyCmd.Stdin = reader
+
+	stderr := bytes.Buffer{}
+	copyCmd.Stderr = &stderr
+
+	err := copyCmd.Run()
+	// Unblocks the tar writer if the command has exited before reading it all
+	reader.Close()
+
+	if stderr.Len() > 0 {
+		println(stderr.String())
+	}
+
+	return err
+}
+
+// copyThroughShell streams the files one by one to cat of the container
+func (t transport) copyThroughShell(pod *k8s.Endpoint, syncFilesMap map[string]string) error {
+	const script = `d="${1%/*}"; [ -z "$d" ] || mkdir -p "$d" && cat > "$1"`
+
+	for localPath, podPath := range syncFilesMap {
+		file, err := os.Open(localPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		copyCmd := pod.CLI.Command(
+			context.Background(),
+			"exec",
+			pod.PodName,
+			"-c", t.container, "-i", "--", "sh", "-c", script, "sh", path.Join(t.root, podPath),
+		)
+
+		copyCmd.Stdin = file
+
+		stderr := bytes.Buffer{}
+		copyCmd.Stderr = &stderr
+
+		err = copyCmd.Run()
+		file.Close()
+
+		if stderr.Len() > 0 {
+			println(stderr.String())
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", podPath, err)
+		}
+	}
+
+	return nil
+}